@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// aggregators consume the values of a column one by one.
+// NULLs are ignored by all of them but count(*),
+// which takes arg "*" and counts the tuples themselves
+type aggregator interface {
+	name() string
+	arg() string
+	add(v interface{})
+	result() interface{}
+	reset()
+}
+
+func newAggregator(fn string, arg string) (aggregator, error) {
+	switch strings.ToUpper(fn) {
+	case "COUNT":
+		return newCount(arg), nil
+	case "SUM":
+		return newSum(arg), nil
+	case "AVG":
+		return newAvg(arg), nil
+	case "MIN":
+		return newMin(arg), nil
+	case "MAX":
+		return newMax(arg), nil
+	}
+	return nil, fmt.Errorf("unknown aggregate function: %s", fn)
+}
+
+type countAgg struct {
+	col string
+	n   int
+}
+
+func newCount(col string) *countAgg {
+	return &countAgg{col: col}
+}
+
+func (a *countAgg) name() string {
+	return "count(" + a.col + ")"
+}
+
+func (a *countAgg) arg() string {
+	return a.col
+}
+
+func (a *countAgg) add(v interface{}) {
+	if a.col == "*" || v != nil {
+		a.n++
+	}
+}
+
+func (a *countAgg) result() interface{} {
+	return a.n
+}
+
+func (a *countAgg) reset() {
+	a.n = 0
+}
+
+// sumAgg keeps the sum as an int until it meets a float
+type sumAgg struct {
+	col     string
+	isum    int
+	fsum    float64
+	isFloat bool
+	seen    bool
+}
+
+func newSum(col string) *sumAgg {
+	return &sumAgg{col: col}
+}
+
+func (a *sumAgg) name() string {
+	return "sum(" + a.col + ")"
+}
+
+func (a *sumAgg) arg() string {
+	return a.col
+}
+
+func (a *sumAgg) add(v interface{}) {
+	switch n := v.(type) {
+	case int:
+		a.isum += n
+		a.fsum += float64(n)
+	case float64:
+		a.isFloat = true
+		a.fsum += n
+	default:
+		return
+	}
+	a.seen = true
+}
+
+func (a *sumAgg) result() interface{} {
+	switch {
+	case !a.seen:
+		return nil
+	case a.isFloat:
+		return a.fsum
+	}
+	return a.isum
+}
+
+func (a *sumAgg) reset() {
+	*a = sumAgg{col: a.col}
+}
+
+type avgAgg struct {
+	col string
+	sum float64
+	n   int
+}
+
+func newAvg(col string) *avgAgg {
+	return &avgAgg{col: col}
+}
+
+func (a *avgAgg) name() string {
+	return "avg(" + a.col + ")"
+}
+
+func (a *avgAgg) arg() string {
+	return a.col
+}
+
+func (a *avgAgg) add(v interface{}) {
+	switch n := v.(type) {
+	case int:
+		a.sum += float64(n)
+	case float64:
+		a.sum += n
+	default:
+		return
+	}
+	a.n++
+}
+
+func (a *avgAgg) result() interface{} {
+	if a.n == 0 {
+		return nil
+	}
+	return a.sum / float64(a.n)
+}
+
+func (a *avgAgg) reset() {
+	a.sum = 0
+	a.n = 0
+}
+
+// extremumAgg implements both of min and max,
+// whose sign is -1 and 1 respectively
+type extremumAgg struct {
+	fn   string
+	col  string
+	sign int
+	v    interface{}
+}
+
+func newMin(col string) *extremumAgg {
+	return &extremumAgg{fn: "min", col: col, sign: -1}
+}
+
+func newMax(col string) *extremumAgg {
+	return &extremumAgg{fn: "max", col: col, sign: 1}
+}
+
+func (a *extremumAgg) name() string {
+	return a.fn + "(" + a.col + ")"
+}
+
+func (a *extremumAgg) arg() string {
+	return a.col
+}
+
+func (a *extremumAgg) add(v interface{}) {
+	if v == nil {
+		return
+	}
+	if a.v == nil {
+		a.v = v
+		return
+	}
+	if c, ok := compareValues(v, a.v); ok && c == a.sign {
+		a.v = v
+	}
+}
+
+func (a *extremumAgg) result() interface{} {
+	return a.v
+}
+
+func (a *extremumAgg) reset() {
+	a.v = nil
+}
+
+// groupBy makes one tuple for each distinct combination of the values
+// of the columns, in order of first appearance, followed by the aggregated
+// values. NULLs are grouped together as GROUP BY in SQL does,
+// unlike in comparisons. no columns put all the tuples into a single group.
+// groups can be filtered afterwards by the columns named after aggregators,
+// which is what HAVING does
+func (r *relation) groupBy(colNames []string, aggs ...aggregator) *relation {
+	if r.err != nil {
+		return r
+	}
+	newCols := []*column{}
+	idxs := []int{}
+	for _, cn := range colNames {
+		idx, err := r.lookupColumn(cn)
+		if err != nil {
+			return r.fail(err)
+		}
+		idxs = append(idxs, idx)
+		newCols = append(newCols, r.columns[idx])
+	}
+	argIdxs := []int{}
+	for _, a := range aggs {
+		argIdx := -1
+		if a.arg() != "*" {
+			idx, err := r.lookupColumn(a.arg())
+			if err != nil {
+				return r.fail(err)
+			}
+			argIdx = idx
+		}
+		argIdxs = append(argIdxs, argIdx)
+		newCols = append(newCols, newColumn("", a.name()))
+	}
+
+	if len(idxs) == 0 {
+		// the whole relation is a group even if it is empty,
+		// whose tuples are aggregated one at a time
+		for _, a := range aggs {
+			a.reset()
+		}
+		err := r.each(func(tup *tuple) error {
+			for i, a := range aggs {
+				addTuple(a, tup, argIdxs[i])
+			}
+			return nil
+		})
+		if err != nil {
+			return r.fail(err)
+		}
+		vals := []interface{}{}
+		for _, a := range aggs {
+			vals = append(vals, a.result())
+		}
+		return newRelation(newCols, []*tuple{newTuple(vals)})
+	}
+
+	if r = r.load(); r.err != nil {
+		return r
+	}
+	keys := [][]interface{}{}
+	groups := map[string][]*tuple{}
+	for _, tup := range r.tuples {
+		k := []interface{}{}
+		for _, idx := range idxs {
+			k = append(k, tup.values[idx])
+		}
+		hk := hashKey(k)
+		if _, ok := groups[hk]; !ok {
+			keys = append(keys, k)
+		}
+		groups[hk] = append(groups[hk], tup)
+	}
+
+	newTups := []*tuple{}
+	for _, k := range keys {
+		group := groups[hashKey(k)]
+		vals := []interface{}{}
+		vals = append(vals, k...)
+		for i, a := range aggs {
+			a.reset()
+			for _, tup := range group {
+				addTuple(a, tup, argIdxs[i])
+			}
+			vals = append(vals, a.result())
+		}
+		newTups = append(newTups, newTuple(vals))
+	}
+	return newRelation(newCols, newTups)
+}
+
+// addTuple adds the value of the tuple at argIdx to the aggregator,
+// or the tuple itself if argIdx is negative, as for COUNT(*)
+func addTuple(a aggregator, tup *tuple, argIdx int) {
+	if argIdx < 0 {
+		a.add(tup)
+	} else {
+		a.add(tup.values[argIdx])
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func feed(a aggregator, vals ...interface{}) interface{} {
+	a.reset()
+	for _, v := range vals {
+		a.add(v)
+	}
+	return a.result()
+}
+
+func TestCountAll(t *testing.T) {
+	a := newCount("*")
+	assert.Equal(t, "count(*)", a.name())
+	assert.Equal(t, 3, feed(a, 1, nil, 2))
+	assert.Equal(t, 0, feed(a))
+}
+
+func TestCountColumn(t *testing.T) {
+	a := newCount("price")
+	assert.Equal(t, "count(price)", a.name())
+	assert.Equal(t, 2, feed(a, 1, nil, 2))
+}
+
+func TestSumInt(t *testing.T) {
+	a := newSum("price")
+	assert.Equal(t, "sum(price)", a.name())
+	assert.Equal(t, 3, feed(a, 1, nil, 2))
+}
+
+func TestSumFloat(t *testing.T) {
+	assert.Equal(t, 3.5, feed(newSum("price"), 1, 2.5))
+}
+
+func TestSumNull(t *testing.T) {
+	a := newSum("price")
+	assert.Nil(t, feed(a))
+	assert.Nil(t, feed(a, nil, nil))
+}
+
+func TestAvg(t *testing.T) {
+	a := newAvg("price")
+	assert.Equal(t, "avg(price)", a.name())
+	assert.Equal(t, 1.5, feed(a, 1, nil, 2))
+	assert.Nil(t, feed(a, nil))
+}
+
+func TestMin(t *testing.T) {
+	a := newMin("price")
+	assert.Equal(t, "min(price)", a.name())
+	assert.Equal(t, 1, feed(a, 2, nil, 1, 3))
+	assert.Equal(t, "apple", feed(a, "orange", "apple"))
+	assert.Nil(t, feed(a, nil))
+}
+
+func TestMax(t *testing.T) {
+	a := newMax("price")
+	assert.Equal(t, "max(price)", a.name())
+	assert.Equal(t, 3, feed(a, 2, nil, 3, 1))
+	assert.Nil(t, feed(a))
+}
+
+func TestNewAggregatorUnknown(t *testing.T) {
+	_, err := newAggregator("MEDIAN", "price")
+	assert.Error(t, err)
+}
+
+func TestGroupByUnknown(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "type"), newColumn("", "price")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1, 100}},
+		},
+	}
+	res := r.groupBy([]string{"unknown"}, newSum("price"))
+	assert.Equal(t, 0, len(res.tuples))
+	res = r.groupBy([]string{"type"}, newSum("unknown"))
+	assert.Equal(t, 0, len(res.tuples))
+}
+
+func TestGroupByProper(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "type"), newColumn("", "price")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{2, 100}},
+			&tuple{values: []interface{}{1, 200}},
+			&tuple{values: []interface{}{2, 300}},
+			&tuple{values: []interface{}{nil, 400}},
+			&tuple{values: []interface{}{1, nil}},
+		},
+	}
+	res := r.groupBy([]string{"type"}, newCount("*"), newAvg("price"))
+	assert.Equal(t, []*column{
+		newColumn("", "type"),
+		newColumn("", "count(*)"),
+		newColumn("", "avg(price)"),
+	}, res.columns)
+	assert.Equal(t, 3, len(res.tuples))
+	assert.Equal(t, []interface{}{2, 2, 200.0}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, 2, 200.0}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{nil, 1, 400.0}, res.tuples[2].values)
+}
+
+func TestGroupByWhole(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "price")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{100}},
+			&tuple{values: []interface{}{300}},
+		},
+	}
+	res := r.groupBy(nil, newCount("*"), newMax("price"))
+	assert.Equal(t, 2, len(res.columns))
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{2, 300}, res.tuples[0].values)
+}
+
+func TestGroupByWholeEmpty(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "price")},
+		tuples:  []*tuple{},
+	}
+	res := r.groupBy(nil, newCount("*"), newSum("price"))
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{0, nil}, res.tuples[0].values)
+}
+
+func TestGroupByMultiple(t *testing.T) {
+	r := &relation{
+		columns: []*column{
+			newColumn("", "type"), newColumn("", "supplier"),
+			newColumn("", "price"),
+		},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1, "a", 100}},
+			&tuple{values: []interface{}{1, "b", 200}},
+			&tuple{values: []interface{}{1, "a", 300}},
+			&tuple{values: []interface{}{2, "a", 400}},
+		},
+	}
+	res := r.groupBy([]string{"type", "supplier"}, newSum("price"))
+	assert.Equal(t, 3, len(res.columns))
+	assert.Equal(t, 3, len(res.tuples))
+	assert.Equal(t, []interface{}{1, "a", 400}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, "b", 200}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{2, "a", 400}, res.tuples[2].values)
+}
+
+func TestGroupByNumericKeys(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "type")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1}},
+			&tuple{values: []interface{}{1.0}},
+			&tuple{values: []interface{}{"1"}},
+		},
+	}
+	res := r.groupBy([]string{"type"}, newCount("*"))
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, []interface{}{1, 2}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{"1", 1}, res.tuples[1].values)
+}
+
+func TestGroupByHaving(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "type"), newColumn("", "price")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1, 100}},
+			&tuple{values: []interface{}{2, 200}},
+			&tuple{values: []interface{}{1, 300}},
+		},
+	}
+	res := r.groupBy([]string{"type"}, newCount("*")).lessThan("count(*)", 2)
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{2, 1}, res.tuples[0].values)
+}
+
+func TestGroupByPropagated(t *testing.T) {
+	res := from("TestGroupByPropagated").groupBy(nil, newCount("*"))
+	assert.IsType(t, &ErrUnknownTable{}, res.err)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"sort"
+)
+
+// indexKey is an entry of a B+tree. the rowID breaks the ties
+// of the equal values, so that every entry is distinct and
+// the rows of the same value are in order of their rowIDs
+type indexKey struct {
+	value interface{}
+	rid   rowID
+}
+
+func compareIndexKeys(a, b indexKey) int {
+	if c := compareForSort(a.value, b.value, false); c != 0 {
+		return c
+	}
+	return compareInts(int(a.rid), int(b.rid))
+}
+
+// btree is a B+tree of indexKeys. the internal nodes hold the separators,
+// where the keys in children[i+1] are not less than keys[i],
+// and the leaves hold the entries, linked in order for range scans
+type btree struct {
+	root  *btreeNode
+	order int // the maximum number of the children of a node
+	size  int
+}
+
+type btreeNode struct {
+	leaf     bool
+	keys     []indexKey
+	children []*btreeNode
+	next     *btreeNode
+}
+
+const defaultBTreeOrder = 64
+
+func newBTree(order int) *btree {
+	return &btree{root: &btreeNode{leaf: true}, order: order}
+}
+
+func (bt *btree) maxKeys() int {
+	return bt.order - 1
+}
+
+func (bt *btree) minKeys() int {
+	return (bt.order - 1) / 2
+}
+
+// childIndex returns the child of n in which k is or should be
+func (n *btreeNode) childIndex(k indexKey) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return compareIndexKeys(k, n.keys[i]) < 0
+	})
+}
+
+// insert adds the key, reporting false if it is already in the tree
+func (bt *btree) insert(k indexKey) bool {
+	sep, right, ok := bt.insertAt(bt.root, k)
+	if !ok {
+		return false
+	}
+	if right != nil {
+		bt.root = &btreeNode{
+			keys:     []indexKey{sep},
+			children: []*btreeNode{bt.root, right},
+		}
+	}
+	bt.size++
+	return true
+}
+
+// insertAt adds the key to the subtree of n. if n is split,
+// it returns the new right node and the separator of them
+func (bt *btree) insertAt(n *btreeNode, k indexKey) (indexKey, *btreeNode, bool) {
+	if n.leaf {
+		i := sort.Search(len(n.keys), func(i int) bool {
+			return compareIndexKeys(n.keys[i], k) >= 0
+		})
+		if i < len(n.keys) && compareIndexKeys(n.keys[i], k) == 0 {
+			return indexKey{}, nil, false
+		}
+		n.keys = insertKey(n.keys, i, k)
+		if len(n.keys) <= bt.maxKeys() {
+			return indexKey{}, nil, true
+		}
+		mid := len(n.keys) / 2
+		right := &btreeNode{leaf: true, next: n.next}
+		right.keys = append(right.keys, n.keys[mid:]...)
+		n.keys = n.keys[:mid:mid]
+		n.next = right
+		return right.keys[0], right, true
+	}
+	i := n.childIndex(k)
+	sep, child, ok := bt.insertAt(n.children[i], k)
+	if !ok || child == nil {
+		return indexKey{}, nil, ok
+	}
+	n.keys = insertKey(n.keys, i, sep)
+	n.children = insertNode(n.children, i+1, child)
+	if len(n.keys) <= bt.maxKeys() {
+		return indexKey{}, nil, true
+	}
+	mid := len(n.keys) / 2
+	sep = n.keys[mid]
+	right := &btreeNode{}
+	right.keys = append(right.keys, n.keys[mid+1:]...)
+	right.children = append(right.children, n.children[mid+1:]...)
+	n.keys = n.keys[:mid:mid]
+	n.children = n.children[: mid+1 : mid+1]
+	return sep, right, true
+}
+
+// delete removes the key, reporting false if it is not in the tree
+func (bt *btree) delete(k indexKey) bool {
+	if !bt.deleteAt(bt.root, k) {
+		return false
+	}
+	if !bt.root.leaf && len(bt.root.keys) == 0 {
+		bt.root = bt.root.children[0]
+	}
+	bt.size--
+	return true
+}
+
+func (bt *btree) deleteAt(n *btreeNode, k indexKey) bool {
+	if n.leaf {
+		i := sort.Search(len(n.keys), func(i int) bool {
+			return compareIndexKeys(n.keys[i], k) >= 0
+		})
+		if i == len(n.keys) || compareIndexKeys(n.keys[i], k) != 0 {
+			return false
+		}
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+		return true
+	}
+	i := n.childIndex(k)
+	if !bt.deleteAt(n.children[i], k) {
+		return false
+	}
+	// the separators are left as they are,
+	// since they still divide the keys correctly
+	if len(n.children[i].keys) < bt.minKeys() {
+		bt.rebalance(n, i)
+	}
+	return true
+}
+
+// rebalance fills up the underflowing child of n at i
+// by borrowing a key from a sibling, or by merging it with one
+func (bt *btree) rebalance(n *btreeNode, i int) {
+	child := n.children[i]
+	if i > 0 && len(n.children[i-1].keys) > bt.minKeys() {
+		left := n.children[i-1]
+		last := len(left.keys) - 1
+		if child.leaf {
+			child.keys = insertKey(child.keys, 0, left.keys[last])
+			n.keys[i-1] = child.keys[0]
+		} else {
+			child.keys = insertKey(child.keys, 0, n.keys[i-1])
+			child.children = insertNode(child.children, 0, left.children[last+1])
+			n.keys[i-1] = left.keys[last]
+			left.children = left.children[:last+1]
+		}
+		left.keys = left.keys[:last]
+		return
+	}
+	if i+1 < len(n.children) && len(n.children[i+1].keys) > bt.minKeys() {
+		right := n.children[i+1]
+		if child.leaf {
+			child.keys = append(child.keys, right.keys[0])
+			right.keys = append(right.keys[:0], right.keys[1:]...)
+			n.keys[i] = right.keys[0]
+		} else {
+			child.keys = append(child.keys, n.keys[i])
+			child.children = append(child.children, right.children[0])
+			n.keys[i] = right.keys[0]
+			right.keys = append(right.keys[:0], right.keys[1:]...)
+			right.children = append(right.children[:0], right.children[1:]...)
+		}
+		return
+	}
+	if i > 0 {
+		i--
+	}
+	// merge the children at i and i+1
+	left, right := n.children[i], n.children[i+1]
+	if left.leaf {
+		left.keys = append(left.keys, right.keys...)
+		left.next = right.next
+	} else {
+		left.keys = append(left.keys, n.keys[i])
+		left.keys = append(left.keys, right.keys...)
+		left.children = append(left.children, right.children...)
+	}
+	n.keys = append(n.keys[:i], n.keys[i+1:]...)
+	n.children = append(n.children[:i+1], n.children[i+2:]...)
+}
+
+// scan calls f for the keys in order, from the first one for which
+// from is true, until f returns false. from must be false for the keys
+// before some point and true for all the keys after it
+func (bt *btree) scan(from func(k indexKey) bool, f func(k indexKey) bool) {
+	n := bt.root
+	for !n.leaf {
+		n = n.children[sort.Search(len(n.keys), func(i int) bool {
+			return from(n.keys[i])
+		})]
+	}
+	i := sort.Search(len(n.keys), func(i int) bool {
+		return from(n.keys[i])
+	})
+	for ; n != nil; n, i = n.next, 0 {
+		for ; i < len(n.keys); i++ {
+			if !f(n.keys[i]) {
+				return
+			}
+		}
+	}
+}
+
+func insertKey(keys []indexKey, i int, k indexKey) []indexKey {
+	keys = append(keys, indexKey{})
+	copy(keys[i+1:], keys[i:])
+	keys[i] = k
+	return keys
+}
+
+func insertNode(nodes []*btreeNode, i int, n *btreeNode) []*btreeNode {
+	nodes = append(nodes, nil)
+	copy(nodes[i+1:], nodes[i:])
+	nodes[i] = n
+	return nodes
+}
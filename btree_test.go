@@ -0,0 +1,98 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func btreeKeys(bt *btree) []indexKey {
+	keys := []indexKey{}
+	bt.scan(
+		func(k indexKey) bool { return true },
+		func(k indexKey) bool {
+			keys = append(keys, k)
+			return true
+		},
+	)
+	return keys
+}
+
+// checkBTree checks that the leaves are at the same depth
+// and the nodes other than the root have enough keys
+func checkBTree(t *testing.T, bt *btree, n *btreeNode, depth int) int {
+	if n != bt.root {
+		assert.True(t, len(n.keys) >= bt.minKeys())
+	}
+	assert.True(t, len(n.keys) <= bt.maxKeys())
+	if n.leaf {
+		return depth
+	}
+	assert.Equal(t, len(n.keys)+1, len(n.children))
+	leafDepth := checkBTree(t, bt, n.children[0], depth+1)
+	for _, c := range n.children[1:] {
+		assert.Equal(t, leafDepth, checkBTree(t, bt, c, depth+1))
+	}
+	return leafDepth
+}
+
+func TestBTreeInsert(t *testing.T) {
+	bt := newBTree(4)
+	for _, i := range rand.New(rand.NewSource(1)).Perm(200) {
+		assert.True(t, bt.insert(indexKey{i % 50, rowID(i)}))
+	}
+	assert.False(t, bt.insert(indexKey{0, 0}))
+	assert.Equal(t, 200, bt.size)
+	checkBTree(t, bt, bt.root, 0)
+	keys := btreeKeys(bt)
+	assert.Equal(t, 200, len(keys))
+	assert.Equal(t, indexKey{0, 0}, keys[0])
+	assert.Equal(t, indexKey{0, 50}, keys[1])
+	assert.Equal(t, indexKey{49, 199}, keys[199])
+}
+
+func TestBTreeDelete(t *testing.T) {
+	bt := newBTree(4)
+	for i := 0; i < 200; i++ {
+		bt.insert(indexKey{i, rowID(i)})
+	}
+	for _, i := range rand.New(rand.NewSource(1)).Perm(200)[:150] {
+		assert.True(t, bt.delete(indexKey{i, rowID(i)}))
+		checkBTree(t, bt, bt.root, 0)
+	}
+	assert.False(t, bt.delete(indexKey{1000, 1000}))
+	assert.Equal(t, 50, bt.size)
+	keys := btreeKeys(bt)
+	assert.Equal(t, 50, len(keys))
+	for i := 1; i < len(keys); i++ {
+		assert.True(t, compareIndexKeys(keys[i-1], keys[i]) < 0)
+	}
+}
+
+func TestBTreeDeleteAll(t *testing.T) {
+	bt := newBTree(3)
+	for i := 0; i < 100; i++ {
+		bt.insert(indexKey{i, rowID(i)})
+	}
+	for i := 0; i < 100; i++ {
+		bt.delete(indexKey{i, rowID(i)})
+	}
+	assert.True(t, bt.root.leaf)
+	assert.Equal(t, 0, len(btreeKeys(bt)))
+}
+
+func TestBTreeScanFrom(t *testing.T) {
+	bt := newBTree(4)
+	for i := 0; i < 100; i++ {
+		bt.insert(indexKey{i, rowID(i)})
+	}
+	keys := []indexKey{}
+	bt.scan(
+		func(k indexKey) bool { return k.value.(int) >= 42 },
+		func(k indexKey) bool {
+			keys = append(keys, k)
+			return len(keys) < 3
+		},
+	)
+	assert.Equal(t, []indexKey{{42, 42}, {43, 43}, {44, 44}}, keys)
+}
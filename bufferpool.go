@@ -0,0 +1,210 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+)
+
+type pageID uint32
+
+// pageFile is a file of fixed-size pages
+type pageFile struct {
+	f      *os.File
+	nPages int
+}
+
+func openPageFile(path string) (*pageFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size()%pageSize != 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s: not a page file", path)
+	}
+	return &pageFile{f: f, nPages: int(info.Size() / pageSize)}, nil
+}
+
+func (pf *pageFile) read(id pageID, p page) error {
+	_, err := pf.f.ReadAt(p, int64(id)*pageSize)
+	if err == io.EOF {
+		return fmt.Errorf("page %d out of %d pages", id, pf.nPages)
+	}
+	return err
+}
+
+func (pf *pageFile) write(id pageID, p page) error {
+	_, err := pf.f.WriteAt(p, int64(id)*pageSize)
+	return err
+}
+
+func (pf *pageFile) close() error {
+	return pf.f.Close()
+}
+
+type pageKey struct {
+	file *pageFile
+	id   pageID
+}
+
+// frame holds a page in the buffer pool.
+// a pinned frame is in use and never evicted
+type frame struct {
+	key   pageKey
+	data  page
+	pins  int
+	dirty bool
+	elem  *list.Element
+}
+
+func (fr *frame) id() pageID {
+	return fr.key.id
+}
+
+// bufferPool caches the pages of the files up to its capacity,
+// evicting the least recently used page among the unpinned ones.
+// the dirty pages are written back when evicted or flushed
+type bufferPool struct {
+	capacity int
+	frames   map[pageKey]*frame
+	lru      *list.List // unpinned frames, the least recently used first
+}
+
+func newBufferPool(capacity int) *bufferPool {
+	return &bufferPool{
+		capacity: capacity,
+		frames:   map[pageKey]*frame{},
+		lru:      list.New(),
+	}
+}
+
+// fetch pins the page, reading it from the file unless it is cached
+func (bp *bufferPool) fetch(pf *pageFile, id pageID) (*frame, error) {
+	key := pageKey{pf, id}
+	if fr, ok := bp.frames[key]; ok {
+		bp.pin(fr)
+		return fr, nil
+	}
+	if int(id) >= pf.nPages {
+		return nil, fmt.Errorf("page %d out of %d pages", id, pf.nPages)
+	}
+	fr, err := bp.newFrame(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := pf.read(id, fr.data); err != nil {
+		delete(bp.frames, key)
+		return nil, err
+	}
+	return fr, nil
+}
+
+// allocate pins a new empty page at the end of the file
+func (bp *bufferPool) allocate(pf *pageFile) (*frame, error) {
+	key := pageKey{pf, pageID(pf.nPages)}
+	fr, err := bp.newFrame(key)
+	if err != nil {
+		return nil, err
+	}
+	copy(fr.data, newPage())
+	// the page is written at once, so that the file has no holes
+	if err := pf.write(key.id, fr.data); err != nil {
+		delete(bp.frames, key)
+		return nil, err
+	}
+	pf.nPages++
+	return fr, nil
+}
+
+// unpin releases the page, which is marked dirty if it has been modified
+func (bp *bufferPool) unpin(fr *frame, dirty bool) {
+	fr.dirty = fr.dirty || dirty
+	fr.pins--
+	if fr.pins == 0 {
+		fr.elem = bp.lru.PushBack(fr)
+	}
+}
+
+func (bp *bufferPool) pin(fr *frame) {
+	if fr.pins == 0 {
+		bp.lru.Remove(fr.elem)
+		fr.elem = nil
+	}
+	fr.pins++
+}
+
+// newFrame makes a pinned frame for the page, evicting another if full
+func (bp *bufferPool) newFrame(key pageKey) (*frame, error) {
+	if len(bp.frames) >= bp.capacity {
+		if err := bp.evict(); err != nil {
+			return nil, err
+		}
+	}
+	fr := &frame{key: key, data: make(page, pageSize), pins: 1}
+	bp.frames[key] = fr
+	return fr, nil
+}
+
+func (bp *bufferPool) evict() error {
+	elem := bp.lru.Front()
+	if elem == nil {
+		return fmt.Errorf("all the %d pages are pinned", bp.capacity)
+	}
+	fr := elem.Value.(*frame)
+	if err := bp.writeBack(fr); err != nil {
+		return err
+	}
+	bp.lru.Remove(elem)
+	delete(bp.frames, fr.key)
+	return nil
+}
+
+func (bp *bufferPool) writeBack(fr *frame) error {
+	if !fr.dirty {
+		return nil
+	}
+	if err := fr.key.file.write(fr.key.id, fr.data); err != nil {
+		return err
+	}
+	fr.dirty = false
+	return nil
+}
+
+// flush writes back the dirty pages of the file and syncs it
+func (bp *bufferPool) flush(pf *pageFile) error {
+	for key, fr := range bp.frames {
+		if key.file != pf {
+			continue
+		}
+		if err := bp.writeBack(fr); err != nil {
+			return err
+		}
+	}
+	return pf.f.Sync()
+}
+
+// release flushes the pages of the file, and drops them from the pool
+func (bp *bufferPool) release(pf *pageFile) error {
+	for key, fr := range bp.frames {
+		if key.file == pf && fr.pins > 0 {
+			return fmt.Errorf("page %d is pinned", key.id)
+		}
+	}
+	if err := bp.flush(pf); err != nil {
+		return err
+	}
+	for key, fr := range bp.frames {
+		if key.file == pf {
+			bp.lru.Remove(fr.elem)
+			delete(bp.frames, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func openTestPageFile(t *testing.T) *pageFile {
+	pf, err := openPageFile(filepath.Join(t.TempDir(), "test.pages"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pf.close() })
+	return pf
+}
+
+func TestBufferPoolEvictLRU(t *testing.T) {
+	pf := openTestPageFile(t)
+	bp := newBufferPool(2)
+	for i := 0; i < 3; i++ {
+		fr, err := bp.allocate(pf)
+		assert.NoError(t, err)
+		bp.unpin(fr, false)
+	}
+	assert.Equal(t, 2, len(bp.frames))
+	fr, _ := bp.fetch(pf, 1)
+	bp.unpin(fr, false)
+	fr, _ = bp.fetch(pf, 0)
+	bp.unpin(fr, false)
+	_, ok := bp.frames[pageKey{pf, 2}]
+	assert.False(t, ok, "it should evict the least recently used")
+	_, ok = bp.frames[pageKey{pf, 1}]
+	assert.True(t, ok)
+}
+
+func TestBufferPoolPinned(t *testing.T) {
+	pf := openTestPageFile(t)
+	bp := newBufferPool(2)
+	fr0, _ := bp.allocate(pf)
+	fr1, _ := bp.allocate(pf)
+	_, err := bp.allocate(pf)
+	assert.Error(t, err)
+	bp.unpin(fr0, false)
+	fr2, err := bp.allocate(pf)
+	assert.NoError(t, err)
+	assert.Equal(t, pageID(2), fr2.id())
+	_, ok := bp.frames[pageKey{pf, 1}]
+	assert.True(t, ok, "it should not evict the pinned page")
+	bp.unpin(fr1, false)
+	bp.unpin(fr2, false)
+}
+
+func TestBufferPoolWriteBack(t *testing.T) {
+	pf := openTestPageFile(t)
+	bp := newBufferPool(1)
+	fr, _ := bp.allocate(pf)
+	fr.data.insert([]byte("apple"))
+	bp.unpin(fr, true)
+	fr, _ = bp.allocate(pf)
+	bp.unpin(fr, false)
+	fr, err := bp.fetch(pf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("apple"), fr.data.get(0))
+	bp.unpin(fr, false)
+}
+
+func TestBufferPoolOutOfFile(t *testing.T) {
+	pf := openTestPageFile(t)
+	_, err := newBufferPool(1).fetch(pf, 0)
+	assert.Error(t, err)
+}
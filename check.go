@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// notNullDef declares that the column never has NULL
+type notNullDef struct {
+	column string
+}
+
+func notNull(colName string) notNullDef {
+	return notNullDef{column: colName}
+}
+
+func (d notNullDef) addTo(t *table) error {
+	idx, err := t.lookupColumn(d.column)
+	if err != nil {
+		return err
+	}
+	t.columns[idx].notNull = true
+	return nil
+}
+
+// defaultDef declares the value of the column for the rows inserted
+// without it. the expression refers to no columns, and is evaluated
+// for each of the rows
+type defaultDef struct {
+	column string
+	value  expr
+}
+
+func defaultTo(colName string, e expr) defaultDef {
+	return defaultDef{column: colName, value: e}
+}
+
+func (d defaultDef) addTo(t *table) error {
+	idx, err := t.lookupColumn(d.column)
+	if err != nil {
+		return err
+	}
+	if _, err := d.value.compile(newRelation(nil, nil)); err != nil {
+		return fmt.Errorf("%s.%s: DEFAULT: %v", t.name, d.column, err)
+	}
+	if err := writeExpr(&bytes.Buffer{}, d.value); err != nil {
+		return fmt.Errorf("%s.%s: DEFAULT: %v", t.name, d.column, err)
+	}
+	t.columns[idx].dflt = d.value
+	return nil
+}
+
+// checkDef declares a CHECK constraint, a predicate on the columns
+// of each row. it is of the column if declared with it, which only names it
+type checkDef struct {
+	column string
+	cond   expr
+}
+
+func checkExpr(e expr) checkDef {
+	return checkDef{cond: e}
+}
+
+// checkConstraint is a CHECK constraint, which rejects the rows
+// for which the condition is false. as of SQL, UNKNOWN passes it,
+// e.g. price > 0 for a row whose price is NULL
+type checkConstraint struct {
+	name string
+	cond expr
+	test evaluator
+}
+
+func (d checkDef) addTo(t *table) error {
+	base := t.name + "_check"
+	if d.column != "" {
+		if _, err := t.lookupColumn(d.column); err != nil {
+			return err
+		}
+		base = t.name + "_" + d.column + "_check"
+	}
+	// the checks of the same base name are numbered as base1, base2, ...
+	name := base
+	for n := 1; t.findCheck(name) != nil; n++ {
+		name = base + strconv.Itoa(n)
+	}
+	return t.addCheck(name, d.cond)
+}
+
+func (t *table) addCheck(name string, cond expr) error {
+	test, err := cond.compile(newRelation(t.columns, nil))
+	if err != nil {
+		return fmt.Errorf("%s: CHECK: %v", t.name, err)
+	}
+	if err := writeExpr(&bytes.Buffer{}, cond); err != nil {
+		return fmt.Errorf("%s: CHECK: %v", t.name, err)
+	}
+	t.checks = append(t.checks, &checkConstraint{
+		name: name, cond: cond, test: test,
+	})
+	return nil
+}
+
+func (t *table) findCheck(name string) *checkConstraint {
+	for _, c := range t.checks {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// defaultRow returns a row of the default values of the columns,
+// which are NULL for the columns without DEFAULT
+func (t *table) defaultRow() ([]interface{}, error) {
+	row := make([]interface{}, len(t.columns))
+	for i, c := range t.columns {
+		if c.dflt == nil {
+			continue
+		}
+		f, err := c.dflt.compile(newRelation(nil, nil))
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: DEFAULT: %v", t.name, c.name, err)
+		}
+		row[i] = f(&tuple{})
+	}
+	return row, nil
+}
+
+// checkRows checks that each of the rows satisfies NOT NULL
+// and the CHECK constraints of t
+func (t *table) checkRows(rows [][]interface{}) error {
+	for _, row := range rows {
+		for i, c := range t.columns {
+			if c.notNull && row[i] == nil {
+				return &ErrConstraint{
+					t.name, t.name + "_" + c.name + "_not_null",
+					"NULL in column " + c.name,
+				}
+			}
+		}
+		tup := newTuple(row)
+		for _, c := range t.checks {
+			if v := c.test(tup); v != nil && !isTrue(v) {
+				return &ErrConstraint{
+					t.name, c.name, "failing row (" + formatValues(row) + ")",
+				}
+			}
+		}
+	}
+	return nil
+}
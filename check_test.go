@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotNull(t *testing.T) {
+	tbl, _ := create("TestNotNull", []string{"id", "name"}, notNull("name"))
+	defer drop("TestNotNull")
+	assert.NoError(t, tbl.insert(0, "zero"))
+	err := tbl.insert(1, nil)
+	if assert.IsType(t, &ErrConstraint{}, err) {
+		assert.Equal(t,
+			"TestNotNull_name_not_null", err.(*ErrConstraint).Constraint,
+		)
+	}
+	_, err = tbl.update(from(tbl).tuples, map[string]interface{}{"name": nil})
+	assert.IsType(t, &ErrConstraint{}, err)
+	assert.Equal(t, "zero", from(tbl).tuples[0].values[1])
+}
+
+func TestDefault(t *testing.T) {
+	tbl, _ := create("TestDefault", []string{"id", "name", "price"},
+		defaultTo("name", lit("unknown")), defaultTo("price", lit(0)),
+	)
+	defer drop("TestDefault")
+	assert.NoError(t, tbl.insertNamed(map[string]interface{}{"id": 0}))
+	assert.NoError(t, tbl.insertNamed(map[string]interface{}{
+		"id": 1, "name": nil,
+	}))
+	assert.Equal(t, []interface{}{0, "unknown", 0}, from(tbl).tuples[0].values)
+	assert.Equal(t, []interface{}{1, nil, 0}, from(tbl).tuples[1].values,
+		"NULL given explicitly should be kept")
+}
+
+func TestDefaultCurrentTimestamp(t *testing.T) {
+	now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	tbl, _ := create("TestDefaultCurrentTimestamp", []string{"id", "created"},
+		defaultTo("created", call("CURRENT_TIMESTAMP")),
+	)
+	defer drop("TestDefaultCurrentTimestamp")
+	tbl.insertNamed(map[string]interface{}{"id": 0})
+	assert.Equal(t, "2020-01-02 03:04:05", from(tbl).tuples[0].values[1])
+}
+
+func TestCheck(t *testing.T) {
+	tbl, _ := create("TestCheck", []string{"id", "price"},
+		checkExpr(ge(ref("price"), lit(0))),
+		checkExpr(lt(ref("price"), lit(1000))),
+	)
+	defer drop("TestCheck")
+	assert.NoError(t, tbl.insert(0, 300))
+	assert.NoError(t, tbl.insert(1, nil), "UNKNOWN should pass the check")
+	err := tbl.insert(2, -1)
+	if assert.IsType(t, &ErrConstraint{}, err) {
+		assert.Equal(t, "TestCheck_check", err.(*ErrConstraint).Constraint)
+	}
+	_, err = tbl.update(
+		from(tbl).equal("id", 0).tuples, map[string]interface{}{"price": 1000},
+	)
+	if assert.IsType(t, &ErrConstraint{}, err) {
+		assert.Equal(t, "TestCheck_check1", err.(*ErrConstraint).Constraint)
+	}
+}
+
+func TestInvalidChecks(t *testing.T) {
+	for _, c := range []constraintDef{
+		notNull("none"),
+		defaultTo("id", ref("id")),
+		defaultTo("id", call("NOW")),
+		defaultTo("id", lit(int64(0))),
+		checkExpr(gt(ref("none"), lit(0))),
+	} {
+		_, err := create("TestInvalidChecks", []string{"id"}, c)
+		assert.Error(t, err)
+	}
+}
+
+func TestChecksSaveOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withCatalog(func() {
+		create("items", []string{"id", "name", "price"},
+			notNull("name"),
+			defaultTo("price", lit(100)),
+			checkExpr(or(
+				between(ref("price"), lit(0), lit(1000)),
+				not(in(ref("name"), lit("gold"), lit("silver"))),
+			)),
+		)
+		assert.NoError(t, save(path))
+		tables = map[string]*table{}
+		assert.NoError(t, open(path))
+		tbl := tables["items"]
+		assert.True(t, tbl.columns[1].notNull)
+		assert.Equal(t, lit(100), tbl.columns[2].dflt)
+		assert.Error(t, tbl.insert(0, nil, 0))
+		assert.Error(t, tbl.insert(0, "gold", 2000))
+		assert.NoError(t, tbl.insertNamed(map[string]interface{}{"name": "gold"}))
+	})
+}
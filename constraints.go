@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// constraintDef declares a constraint of a table,
+// which is added to the table before it has any rows
+type constraintDef interface {
+	addTo(t *table) error
+}
+
+// keyDef declares a PRIMARY KEY or UNIQUE constraint on the columns
+type keyDef struct {
+	primary bool
+	columns []string
+}
+
+func primaryKey(colNames ...string) keyDef {
+	return keyDef{primary: true, columns: colNames}
+}
+
+func unique(colNames ...string) keyDef {
+	return keyDef{columns: colNames}
+}
+
+// uniqueKey is the constraint that no two rows have the same values
+// of the columns, which is checked by a hash index on them.
+// the rows with NULLs in the columns are not checked, as NULL is equal
+// to nothing, but a primary key rejects them
+type uniqueKey struct {
+	name    string
+	primary bool
+	columns []int
+	index   *index
+}
+
+func (k keyDef) addTo(t *table) error {
+	return t.addKey(k)
+}
+
+func (t *table) addKey(k keyDef) error {
+	if len(k.columns) == 0 {
+		return fmt.Errorf("%s: key of no columns", t.name)
+	}
+	idxs := []int{}
+	for i, cn := range k.columns {
+		idx, err := t.lookupColumn(cn)
+		if err != nil {
+			return err
+		}
+		for _, prev := range k.columns[:i] {
+			if prev == cn {
+				return fmt.Errorf("%s: duplicate column in key: %s", t.name, cn)
+			}
+		}
+		idxs = append(idxs, idx)
+	}
+	name := t.name + "_" + strings.Join(k.columns, "_") + "_key"
+	if k.primary {
+		if t.primaryKey() != nil {
+			return fmt.Errorf("%s: multiple primary keys", t.name)
+		}
+		name = t.name + "_pkey"
+	}
+	ix := newIndex(name, idxs, hashIndex)
+	ix.implicit = true
+	t.indexes = append(t.indexes, ix)
+	t.keys = append(t.keys, &uniqueKey{
+		name: name, primary: k.primary, columns: idxs, index: ix,
+	})
+	return nil
+}
+
+func (t *table) primaryKey() *uniqueKey {
+	for _, k := range t.keys {
+		if k.primary {
+			return k
+		}
+	}
+	return nil
+}
+
+// check checks that the rows, which replace the current tuples if any,
+// satisfy the constraints of t
+func (t *table) check(curs []*tuple, rows [][]interface{}) error {
+	if err := t.checkRows(rows); err != nil {
+		return err
+	}
+	if err := t.checkKeys(curs, rows); err != nil {
+		return err
+	}
+	return t.checkForeignKeys(rows)
+}
+
+// checkKeys checks that the rows, which replace the current tuples if any,
+// keep the keys of t unique among themselves and the other rows.
+// the rows are checked all together before any of them is stored,
+// so that a mutation is never applied partially
+func (t *table) checkKeys(curs []*tuple, rows [][]interface{}) error {
+	replaced := map[rowID]bool{}
+	for _, cur := range curs {
+		replaced[cur.rid] = true
+	}
+	for _, k := range t.keys {
+		seen := map[string]bool{}
+		for _, row := range rows {
+			key := k.index.key(row)
+			if key == nil {
+				if k.primary {
+					return &ErrConstraint{t.name, k.name, "NULL in primary key"}
+				}
+				continue
+			}
+			h := hashKey(key)
+			dup := seen[h]
+			for _, rid := range k.index.lookup(key) {
+				dup = dup || !replaced[rid]
+			}
+			if dup {
+				return &ErrConstraint{
+					t.name, k.name, "duplicate key " + t.formatKey(k, key),
+				}
+			}
+			seen[h] = true
+		}
+	}
+	return nil
+}
+
+// formatKey shows the values of the key, e.g. (item_id)=(1)
+func (t *table) formatKey(k *uniqueKey, key []interface{}) string {
+	names, vals := []string{}, []string{}
+	for i, idx := range k.columns {
+		names = append(names, t.columns[idx].name)
+		vals = append(vals, fmt.Sprint(key[i]))
+	}
+	return "(" + strings.Join(names, ", ") + ")=(" + strings.Join(vals, ", ") + ")"
+}
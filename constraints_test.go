@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrimaryKeyDuplicate(t *testing.T) {
+	tbl, _ := create("TestPrimaryKeyDuplicate", []string{"id", "name"},
+		primaryKey("id"),
+	)
+	defer drop("TestPrimaryKeyDuplicate")
+	assert.NoError(t, tbl.insert(1, "apple"))
+	err := tbl.insert(1.0, "orange")
+	if assert.IsType(t, &ErrConstraint{}, err) {
+		assert.Equal(t,
+			"TestPrimaryKeyDuplicate_pkey", err.(*ErrConstraint).Constraint,
+		)
+	}
+	assert.Equal(t, 1, len(from(tbl).tuples))
+}
+
+func TestPrimaryKeyNull(t *testing.T) {
+	tbl, _ := create("TestPrimaryKeyNull", []string{"id"}, primaryKey("id"))
+	defer drop("TestPrimaryKeyNull")
+	assert.IsType(t, &ErrConstraint{}, tbl.insert(nil))
+}
+
+func TestUniqueNulls(t *testing.T) {
+	tbl, _ := create("TestUniqueNulls", []string{"id"}, unique("id"))
+	defer drop("TestUniqueNulls")
+	assert.NoError(t, tbl.insert(nil))
+	assert.NoError(t, tbl.insert(nil), "NULLs should not be duplicates")
+}
+
+func TestCompositeKey(t *testing.T) {
+	tbl, _ := create("TestCompositeKey", []string{"a", "b"}, unique("a", "b"))
+	defer drop("TestCompositeKey")
+	assert.NoError(t, tbl.insert(1, 1))
+	assert.NoError(t, tbl.insert(1, 2))
+	assert.NoError(t, tbl.insert(2, 1))
+	assert.Error(t, tbl.insert(1, 2))
+	assert.Equal(t, 3, len(from(tbl).tuples))
+}
+
+func TestUpdateKey(t *testing.T) {
+	tbl, _ := create("TestUpdateKey", []string{"id", "name"}, primaryKey("id"))
+	defer drop("TestUpdateKey")
+	tbl.insert(0, "zero")
+	tbl.insert(1, "one")
+	tbl.insert(2, "two")
+	r := from(tbl)
+	_, err := tbl.update(
+		r.equal("id", 0).tuples, map[string]interface{}{"id": 1},
+	)
+	assert.IsType(t, &ErrConstraint{}, err)
+	_, err = tbl.update(
+		r.lessThan("id", 2).tuples, map[string]interface{}{"id": 5},
+	)
+	assert.IsType(t, &ErrConstraint{}, err, "the updated rows should collide")
+	assert.Equal(t, []interface{}{0, 1, 2}, ids(from(tbl)))
+	n, err := tbl.update(
+		r.equal("id", 0).tuples, map[string]interface{}{"id": 0},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestDeletedKeyReused(t *testing.T) {
+	tbl, _ := create("TestDeletedKeyReused", []string{"id"}, primaryKey("id"))
+	defer drop("TestDeletedKeyReused")
+	tbl.insert(0)
+	tbl.delete(from(tbl).tuples)
+	assert.NoError(t, tbl.insert(0))
+}
+
+func TestInvalidKeys(t *testing.T) {
+	_, err := create("TestInvalidKeys", []string{"id"}, unique("none"))
+	assert.Error(t, err)
+	assert.Nil(t, tables["TestInvalidKeys"])
+	_, err = createTable("TestInvalidKeys", []columnDef{{"a", typeAny}},
+		primaryKey("a"), primaryKey("a"),
+	)
+	assert.Error(t, err)
+	_, err = createTable("TestInvalidKeys", []columnDef{{"a", typeAny}},
+		unique("a", "a"),
+	)
+	assert.Error(t, err)
+	_, err = createTable("TestInvalidKeys", []columnDef{{"a", typeAny}},
+		unique(),
+	)
+	assert.Error(t, err)
+}
+
+func TestKeysSaveOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withCatalog(func() {
+		tbl, _ := create("items", []string{"id", "name"},
+			primaryKey("id"), unique("name"),
+		)
+		tbl.insert(0, "apple")
+		assert.NoError(t, save(path))
+		tables = map[string]*table{}
+		assert.NoError(t, open(path))
+		tbl = tables["items"]
+		assert.Equal(t, 2, len(tbl.keys))
+		assert.True(t, tbl.keys[0].primary)
+		assert.Error(t, tbl.insert(0, "orange"))
+		assert.Error(t, tbl.insert(1, "apple"))
+		assert.NoError(t, tbl.insert(1, "orange"))
+	})
+}
+
+func TestKeysPagedTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	pool := newBufferPool(4)
+	tbl, _ := createPagedTable(
+		"TestKeysPagedTable", pagedDefs, path, pool, primaryKey("id"),
+	)
+	tbl.insert(0, "zero")
+	drop("TestKeysPagedTable")
+
+	tbl, err := openPagedTable(path, pool)
+	assert.NoError(t, err)
+	defer drop("TestKeysPagedTable")
+	assert.IsType(t, &ErrConstraint{}, tbl.insert(0, "ZERO"))
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+var errReadOnly = errors.New("read-only table")
+
+// csvStore is a read-only engine which reads the rows from a CSV file
+// whenever the table is scanned. the first line of the file is the header,
+// and the rowID of a row is its line number
+type csvStore struct {
+	path    string
+	columns []*column
+	// offsets are the positions of the rows in the file by their rowIDs,
+	// read when the store is opened and again when the file has changed
+	offsets map[rowID]int64
+	size    int64
+	modTime time.Time
+	// lookups are the rowIDs by the hashKeys of the values of a column,
+	// read by the first lookup of the column since the offsets
+	lookups map[int]map[string][]rowID
+}
+
+// openCSVTable registers the table read from the CSV file at path.
+// without defs, the columns are named by the header and are untyped,
+// and the values are read as integers, reals or texts
+func openCSVTable(name, path string, defs []columnDef) (*table, error) {
+	if _, ok := tables[name]; ok {
+		return nil, fmt.Errorf("table already exists: %s", name)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header, err := csv.NewReader(f).Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: no header: %v", path, err)
+	}
+	if defs == nil {
+		for _, h := range header {
+			defs = append(defs, columnDef{h, typeAny})
+		}
+	} else if len(defs) != len(header) {
+		return nil, fmt.Errorf(
+			"%s: %d columns for %d in the header", path, len(defs), len(header),
+		)
+	}
+	t, err := newTypedTable(name, defs)
+	if err != nil {
+		return nil, err
+	}
+	s := &csvStore{path: path, columns: t.columns}
+	if err := s.index(); err != nil {
+		return nil, err
+	}
+	t.store = s
+	tables[name] = t
+	return t, nil
+}
+
+func (s *csvStore) scan(f func(tup *tuple) error) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = len(s.columns)
+	if _, err := r.Read(); err != nil {
+		return fmt.Errorf("%s: no header: %v", s.path, err)
+	}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.path, err)
+		}
+		line, _ := r.FieldPos(0)
+		tup, err := s.tuple(rowID(line), rec)
+		if err != nil {
+			return err
+		}
+		if err := f(tup); err != nil {
+			return err
+		}
+	}
+}
+
+// tuple parses the fields of the record of the row
+func (s *csvStore) tuple(rid rowID, rec []string) (*tuple, error) {
+	row := make([]interface{}, len(rec))
+	for i, field := range rec {
+		var err error
+		if row[i], err = parseCSVField(s.columns[i].typ, field); err != nil {
+			return nil, fmt.Errorf(
+				"%s:%d: %s: %v", s.path, rid, s.columns[i].name, err,
+			)
+		}
+	}
+	return &tuple{values: row, rid: rid}, nil
+}
+
+// index reads the offsets of the rows, without parsing the fields,
+// and remembers the size and the modification time of the file
+// to tell whether it has changed since
+func (s *csvStore) index() error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = len(s.columns)
+	if _, err := r.Read(); err != nil {
+		return fmt.Errorf("%s: no header: %v", s.path, err)
+	}
+	offsets := map[rowID]int64{}
+	for {
+		offset := r.InputOffset()
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.path, err)
+		}
+		line, _ := r.FieldPos(0)
+		offsets[rowID(line)] = offset
+	}
+	s.offsets, s.size, s.modTime = offsets, info.Size(), info.ModTime()
+	s.lookups = map[int]map[string][]rowID{}
+	return nil
+}
+
+// refresh reads the offsets again if the file has changed
+func (s *csvStore) refresh() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if info.Size() == s.size && info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	return s.index()
+}
+
+// parseCSVField reads the field as a value of the type.
+// an empty field is NULL
+func parseCSVField(typ colType, field string) (interface{}, error) {
+	if field == "" {
+		return nil, nil
+	}
+	switch typ {
+	case typeAny:
+		if n, err := strconv.Atoi(field); err == nil {
+			return n, nil
+		}
+		if x, err := strconv.ParseFloat(field, 64); err == nil {
+			return x, nil
+		}
+		return field, nil
+	case typeInteger:
+		return strconv.Atoi(field)
+	case typeReal:
+		return strconv.ParseFloat(field, 64)
+	case typeBoolean:
+		return strconv.ParseBool(field)
+	case typeBlob:
+		return []byte(field), nil
+	}
+	return field, nil
+}
+
+// fetch reads only the record of the row, from its offset in the file
+func (s *csvStore) fetch(rid rowID) (*tuple, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	offset, ok := s.offsets[rid]
+	if !ok {
+		return nil, errNoRow
+	}
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = len(s.columns)
+	rec, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s:%d: %v", s.path, rid, err)
+	}
+	return s.tuple(rid, rec)
+}
+
+// lookup finds the rows whose value of the column is the key,
+// reading all the values of the column once to look up the others
+func (s *csvStore) lookup(colIdx int, key interface{}) ([]*tuple, bool, error) {
+	if err := s.refresh(); err != nil {
+		return nil, true, err
+	}
+	rids, ok := s.lookups[colIdx]
+	if !ok {
+		rids = map[string][]rowID{}
+		err := s.scan(func(tup *tuple) error {
+			if v := tup.values[colIdx]; v != nil {
+				k := hashKey([]interface{}{v})
+				rids[k] = append(rids[k], tup.rid)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, true, err
+		}
+		s.lookups[colIdx] = rids
+	}
+	tups := []*tuple{}
+	if key == nil {
+		return tups, true, nil
+	}
+	for _, rid := range rids[hashKey([]interface{}{key})] {
+		tup, err := s.fetch(rid)
+		if err != nil {
+			return nil, true, err
+		}
+		tups = append(tups, tup)
+	}
+	return tups, true, nil
+}
+
+func (s *csvStore) insert(row []interface{}) (*tuple, error) {
+	return nil, errReadOnly
+}
+
+func (s *csvStore) update(rid rowID, row []interface{}) (*tuple, error) {
+	return nil, errReadOnly
+}
+
+func (s *csvStore) delete(rid rowID) error {
+	return errReadOnly
+}
+
+func (s *csvStore) close() error {
+	return nil
+}
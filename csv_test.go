@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCSV(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "test.csv")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestCSVTableUntyped(t *testing.T) {
+	path := writeCSV(t, "id,name,price\n0,apple,2.5\n1,,3\n")
+	_, err := openCSVTable("TestCSVTableUntyped", path, nil)
+	assert.NoError(t, err)
+	defer drop("TestCSVTableUntyped")
+	res := from("TestCSVTableUntyped").selectQ("name", "price")
+	assert.NoError(t, res.err)
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, []interface{}{"apple", 2.5}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{nil, 3}, res.tuples[1].values)
+}
+
+func TestCSVTableTyped(t *testing.T) {
+	path := writeCSV(t, "id,price,ok\n0,3,true\n")
+	_, err := openCSVTable("TestCSVTableTyped", path, []columnDef{
+		{"id", typeText}, {"price", typeReal}, {"ok", typeBoolean},
+	})
+	assert.NoError(t, err)
+	defer drop("TestCSVTableTyped")
+	res := from("TestCSVTableTyped")
+	assert.Equal(t, []interface{}{"0", 3.0, true}, res.tuples[0].values)
+}
+
+func TestCSVTableBadValue(t *testing.T) {
+	path := writeCSV(t, "id\n0\nzero\n")
+	openCSVTable("TestCSVTableBadValue", path, []columnDef{{"id", typeInteger}})
+	defer drop("TestCSVTableBadValue")
+	assert.Error(t, from("TestCSVTableBadValue").err)
+}
+
+func TestCSVTableReadOnly(t *testing.T) {
+	path := writeCSV(t, "id\n0\n")
+	tbl, _ := openCSVTable("TestCSVTableReadOnly", path, nil)
+	defer drop("TestCSVTableReadOnly")
+	assert.Equal(t, errReadOnly, tbl.insert(1))
+	_, err := tbl.delete(from(tbl).tuples)
+	assert.Equal(t, errReadOnly, err)
+	assert.Equal(t, 1, len(from(tbl).tuples))
+}
+
+func TestCSVTableNoIndex(t *testing.T) {
+	path := writeCSV(t, "id\n0\n")
+	tbl, _ := openCSVTable("TestCSVTableNoIndex", path, nil)
+	defer drop("TestCSVTableNoIndex")
+	_, err := tbl.createIndex("TestCSVTableNoIndex_id", "id", hashIndex)
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(tbl.indexes))
+}
+
+func TestCSVTableColumnCount(t *testing.T) {
+	path := writeCSV(t, "id,name\n")
+	_, err := openCSVTable("TestCSVTableColumnCount", path, pagedDefs[:1])
+	assert.Error(t, err)
+	assert.Nil(t, tables["TestCSVTableColumnCount"])
+}
+
+func TestCSVTableFetch(t *testing.T) {
+	path := writeCSV(t, "id,name\n0,\"apple\npie\"\n1,orange\n")
+	tbl, _ := openCSVTable("TestCSVTableFetch", path, nil)
+	defer drop("TestCSVTableFetch")
+	tups := from(tbl).tuples
+	assert.Equal(t, 2, len(tbl.store.(*csvStore).offsets))
+	for _, tup := range tups {
+		fetched, err := tbl.store.fetch(tup.rid)
+		assert.NoError(t, err)
+		assert.Equal(t, tup, fetched)
+	}
+	_, err := tbl.store.fetch(tups[1].rid + 1)
+	assert.Equal(t, errNoRow, err)
+}
+
+func TestCSVTableFetchChanged(t *testing.T) {
+	path := writeCSV(t, "id,name\n0,apple\n1,orange\n")
+	tbl, _ := openCSVTable("TestCSVTableFetchChanged", path, nil)
+	defer drop("TestCSVTableFetchChanged")
+	os.WriteFile(path, []byte("id,name\n0,cabbage\n1,saury\n"), 0644)
+	tup, err := tbl.store.fetch(from(tbl).tuples[1].rid)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1, "saury"}, tup.values)
+}
+
+func TestCSVTableLookup(t *testing.T) {
+	path := writeCSV(t, "id,name\n0,apple\n1,orange\n1.0,cabbage\n,saury\n")
+	tbl, _ := openCSVTable("TestCSVTableLookup", path, nil)
+	defer drop("TestCSVTableLookup")
+	res := from(tbl).equal("id", 1).selectQ("name")
+	assert.NoError(t, res.err)
+	assert.Equal(t, []interface{}{"orange"}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{"cabbage"}, res.tuples[1].values)
+	assert.Equal(t, 1, len(tbl.store.(*csvStore).lookups))
+	tups, err := tbl.findRows([]int{1}, []interface{}{"apple"})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{0, "apple"}, tups[0].values)
+	assert.Equal(t, 2, len(tbl.store.(*csvStore).lookups))
+}
+
+func TestCSVTableLookupChanged(t *testing.T) {
+	path := writeCSV(t, "id,name\n0,apple\n1,orange\n")
+	tbl, _ := openCSVTable("TestCSVTableLookupChanged", path, nil)
+	defer drop("TestCSVTableLookupChanged")
+	from(tbl).equal("id", 1)
+	os.WriteFile(path, []byte("id,name\n0,cabbage\n2,saury\n"), 0644)
+	assert.Equal(t, 0, len(from(tbl).equal("id", 1).tuples))
+	assert.Equal(t, 1, len(from(tbl).equal("id", 2).tuples))
+}
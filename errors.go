@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownColumn is carried by a relation
+// when an operator refers to a column which it does not have
+type ErrUnknownColumn struct {
+	Name      string
+	Available []string
+}
+
+func (e *ErrUnknownColumn) Error() string {
+	return fmt.Sprintf(
+		"unknown column %q (available: %s)",
+		e.Name, strings.Join(e.Available, ", "),
+	)
+}
+
+// ErrUnknownTable is carried by a relation
+// when it is taken from a table which is not in the catalog
+type ErrUnknownTable struct {
+	Name string
+}
+
+func (e *ErrUnknownTable) Error() string {
+	return fmt.Sprintf("unknown table %q", e.Name)
+}
+
+// ErrConstraint is returned when a mutation of a table
+// would violate one of its constraints, which is not applied then
+type ErrConstraint struct {
+	Table      string
+	Constraint string
+	Detail     string
+}
+
+func (e *ErrConstraint) Error() string {
+	return fmt.Sprintf(
+		"%s: constraint %s violated: %s", e.Table, e.Constraint, e.Detail,
+	)
+}
+
+// lookupColumn is the same as findColumn,
+// but reports a missing column by ErrUnknownColumn
+func (r *relation) lookupColumn(name string) (int, error) {
+	idx := r.findColumn(name)
+	if idx < len(r.columns) {
+		return idx, nil
+	}
+	names := []string{}
+	for _, c := range r.columns {
+		names = append(names, c.name)
+	}
+	return idx, &ErrUnknownColumn{Name: name, Available: names}
+}
+
+// fail makes an empty relation with the same columns as r,
+// carrying the error to the end of the operator chain
+func (r *relation) fail(err error) *relation {
+	return &relation{columns: r.columns, tuples: []*tuple{}, err: err}
+}
+
+func lookupTable(name string) (*table, error) {
+	t, ok := tables[name]
+	if !ok {
+		return nil, &ErrUnknownTable{Name: name}
+	}
+	return t, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestErrUnknownColumnMessage(t *testing.T) {
+	err := &ErrUnknownColumn{Name: "prise", Available: []string{"id", "price"}}
+	assert.Equal(t, `unknown column "prise" (available: id, price)`, err.Error())
+}
+
+func TestErrUnknownTableMessage(t *testing.T) {
+	err := &ErrUnknownTable{Name: "itmes"}
+	assert.Equal(t, `unknown table "itmes"`, err.Error())
+}
+
+func TestLookupColumnFound(t *testing.T) {
+	r := &relation{columns: []*column{newColumn("", "id")}}
+	idx, err := r.lookupColumn("id")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, idx)
+}
+
+func TestLookupColumnNotFound(t *testing.T) {
+	r := &relation{columns: []*column{newColumn("t", "id")}}
+	_, err := r.lookupColumn("name")
+	assert.Equal(t,
+		&ErrUnknownColumn{Name: "name", Available: []string{"id"}}, err,
+	)
+}
+
+func TestLookupTable(t *testing.T) {
+	tbl, _ := create("TestLookupTable", []string{"id"})
+	res, err := lookupTable("TestLookupTable")
+	assert.NoError(t, err)
+	assert.Equal(t, tbl, res)
+	_, err = lookupTable("TestLookupTableUnknown")
+	assert.Equal(t, &ErrUnknownTable{Name: "TestLookupTableUnknown"}, err)
+}
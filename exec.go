@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+)
+
+// query parses a SELECT statement and evaluates it
+// by composing the relational operators
+func query(src string) (*relation, error) {
+	stmt, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := stmt.(*selectStmt)
+	if !ok {
+		return nil, fmt.Errorf("not a query: %s", src)
+	}
+	return s.run()
+}
+
+type command interface {
+	exec() (int, error)
+}
+
+// exec parses a data-definition or data-manipulation statement
+// and applies it to the catalog, returning the number of affected rows
+func exec(src string) (int, error) {
+	stmt, err := parse(src)
+	if err != nil {
+		return 0, err
+	}
+	c, ok := stmt.(command)
+	if !ok {
+		return 0, fmt.Errorf("not a command: %s", src)
+	}
+	return c.exec()
+}
+
+func (s *selectStmt) run() (*relation, error) {
+	r, err := s.from.run()
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range s.joins {
+		right, err := j.right.run()
+		if err != nil {
+			return nil, err
+		}
+		keys := []joinKey{}
+		for _, k := range j.keys {
+			keys = append(keys, orient(k, r, right))
+		}
+		r = r.joinOn(j.kind, right, keys...)
+	}
+	if s.where != nil {
+		r = r.where(s.where)
+	}
+	if s.groupBy != nil || len(s.aggs) > 0 {
+		if r, err = s.aggregate(r); err != nil {
+			return nil, err
+		}
+		if s.having != nil {
+			r = r.where(s.having)
+		}
+	} else if s.having != nil {
+		return nil, fmt.Errorf("HAVING requires GROUP BY or aggregates")
+	}
+	if s.orderBy != nil {
+		keys := []interface{}{}
+		for _, sk := range s.orderBy {
+			keys = append(keys, sk)
+		}
+		if s.limit != nil {
+			// only the rows up to the limit have to be sorted
+			r = r.top(s.offset+*s.limit, keys...)
+		} else {
+			r = r.orderBy(keys...)
+		}
+	}
+	if s.offset > 0 {
+		r = r.offset(s.offset)
+	}
+	if s.limit != nil {
+		r = r.limit(*s.limit)
+	}
+	if s.columns != nil {
+		r = r.selectQ(s.columns...)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r, nil
+}
+
+// orient swaps the columns of the key if they are written
+// in the opposite order, as in ... JOIN types ON types.id = items.type_id
+func orient(k joinKey, left, right *relation) joinKey {
+	if left.findColumn(k.left) == len(left.columns) &&
+		left.findColumn(k.right) < len(left.columns) &&
+		right.findColumn(k.left) < len(right.columns) {
+		return on(k.right, k.left)
+	}
+	return k
+}
+
+func (s *selectStmt) aggregate(r *relation) (*relation, error) {
+	aggs := []aggregator{}
+	for _, call := range s.aggs {
+		if call.arg == "*" && call.fn != "COUNT" {
+			return nil, fmt.Errorf("%s(*) is not allowed", call.fn)
+		}
+		a, err := newAggregator(call.fn, call.arg)
+		if err != nil {
+			return nil, err
+		}
+		aggs = append(aggs, a)
+	}
+	if s.columns == nil {
+		return nil, fmt.Errorf("* cannot be selected with GROUP BY")
+	}
+	// after grouping, the other columns are no longer available.
+	// they are compared by the columns of r, which they may name
+	// either with or without the table
+	grouped := map[int]bool{}
+	for _, cn := range s.groupBy {
+		idx, err := r.lookupColumn(cn)
+		if err != nil {
+			return nil, err
+		}
+		grouped[idx] = true
+	}
+	aggregated := map[string]bool{}
+	for _, a := range aggs {
+		aggregated[a.name()] = true
+	}
+	for _, cn := range s.columns {
+		if aggregated[cn] {
+			continue
+		}
+		idx, err := r.lookupColumn(cn)
+		if err != nil {
+			return nil, err
+		}
+		if !grouped[idx] {
+			return nil, fmt.Errorf("%s must appear in GROUP BY", cn)
+		}
+	}
+	return r.groupBy(s.groupBy, aggs...), nil
+}
+
+func (tr *tableRef) run() (*relation, error) {
+	if tr.sub != nil {
+		return tr.sub.run()
+	}
+	r := from(tr.name)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r, nil
+}
+
+func (s *createStmt) exec() (int, error) {
+	if _, ok := tables[s.name]; ok {
+		return 0, fmt.Errorf("table already exists: %s", s.name)
+	}
+	if _, err := createTable(s.name, s.columns, s.constraints...); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func (s *createIndexStmt) exec() (int, error) {
+	t, err := lookupTable(s.table)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := t.createIndex(s.name, s.column, s.kind); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func (s *insertStmt) exec() (int, error) {
+	t, err := lookupTable(s.table)
+	if err != nil {
+		return 0, err
+	}
+	idxs := []int{}
+	for i, cn := range s.columns {
+		idx, err := t.lookupColumn(cn)
+		if err != nil {
+			return 0, err
+		}
+		idxs = append(idxs, idx)
+		for _, prev := range s.columns[:i] {
+			if prev == cn {
+				return 0, fmt.Errorf("duplicate column: %s", cn)
+			}
+		}
+	}
+	rows := [][]interface{}{}
+	for _, row := range s.rows {
+		if s.columns == nil {
+			rows = append(rows, row)
+			continue
+		}
+		if len(row) != len(s.columns) {
+			return 0, fmt.Errorf(
+				"%d values for %d columns", len(row), len(s.columns),
+			)
+		}
+		// the columns not in the list have their default values
+		vals, err := t.defaultRow()
+		if err != nil {
+			return 0, err
+		}
+		for i, idx := range idxs {
+			vals[idx] = row[i]
+		}
+		rows = append(rows, vals)
+	}
+	// all the rows are validated in advance not to insert them partially
+	validated := [][]interface{}{}
+	for _, vals := range rows {
+		row, err := t.validate(vals)
+		if err != nil {
+			return 0, err
+		}
+		validated = append(validated, row)
+	}
+	if err := t.check(nil, validated); err != nil {
+		return 0, err
+	}
+	// the rows are checked together, as they may reference each other
+	if err := t.insertRows(validated); err != nil {
+		return 0, err
+	}
+	return len(validated), nil
+}
+
+func (s *updateStmt) exec() (int, error) {
+	t, err := lookupTable(s.table)
+	if err != nil {
+		return 0, err
+	}
+	r := from(s.table)
+	if s.where != nil {
+		r = r.where(s.where)
+	}
+	if r = r.load(); r.err != nil {
+		return 0, r.err
+	}
+	return t.update(r.tuples, s.set)
+}
+
+func (s *deleteStmt) exec() (int, error) {
+	t, err := lookupTable(s.table)
+	if err != nil {
+		return 0, err
+	}
+	r := from(s.table)
+	if s.where != nil {
+		r = r.where(s.where)
+	}
+	if r = r.load(); r.err != nil {
+		return 0, r.err
+	}
+	return t.delete(r.tuples)
+}
+
+func (s *dropStmt) exec() (int, error) {
+	if t, ok := tables[s.name]; ok {
+		for _, ref := range t.referencing() {
+			if ref.from != t {
+				return 0, &ErrConstraint{
+					ref.from.name, ref.fk.name, "references " + s.name,
+				}
+			}
+		}
+	}
+	if !drop(s.name) {
+		return 0, &ErrUnknownTable{Name: s.name}
+	}
+	return 0, journal.failure()
+}
+
+func (s *beginStmt) exec() (int, error) {
+	_, err := begin()
+	return 0, err
+}
+
+func (s *commitStmt) exec() (int, error) {
+	if activeTx == nil {
+		return 0, errNoTransaction
+	}
+	return 0, activeTx.commit()
+}
+
+func (s *rollbackStmt) exec() (int, error) {
+	if activeTx == nil {
+		return 0, errNoTransaction
+	}
+	if s.savepoint != "" {
+		return 0, activeTx.rollbackTo(s.savepoint)
+	}
+	return 0, activeTx.rollback()
+}
+
+func (s *savepointStmt) exec() (int, error) {
+	if activeTx == nil {
+		return 0, errNoTransaction
+	}
+	return 0, activeTx.savepoint(s.name)
+}
+
+func (s *releaseStmt) exec() (int, error) {
+	if activeTx == nil {
+		return 0, errNoTransaction
+	}
+	return 0, activeTx.release(s.name)
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQuerySelectAll(t *testing.T) {
+	tbl, _ := create("TestQuerySelectAll", []string{"id", "name"})
+	tbl.insert(0, "zero")
+	tbl.insert(1, "one")
+	res, err := query("SELECT * FROM TestQuerySelectAll")
+	assert.NoError(t, err)
+	assert.Equal(t, from("TestQuerySelectAll"), res)
+}
+
+func TestQuerySelectColumns(t *testing.T) {
+	tbl, _ := create("TestQuerySelectColumns", []string{"id", "name"})
+	tbl.insert(0, "zero")
+	res, err := query("SELECT name FROM TestQuerySelectColumns")
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]*column{newColumn("TestQuerySelectColumns", "name")}, res.columns,
+	)
+	assert.Equal(t, []interface{}{"zero"}, res.tuples[0].values)
+}
+
+func TestQueryWhere(t *testing.T) {
+	tbl, _ := create("TestQueryWhere", []string{"id", "name"})
+	tbl.insert(0, "zero")
+	tbl.insert(1, "one")
+	tbl.insert(2, "two")
+	res, err := query(
+		"SELECT id FROM TestQueryWhere WHERE id < 2 AND name = 'one'",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{1}, res.tuples[0].values)
+}
+
+func TestQueryWhereTypeMismatch(t *testing.T) {
+	tbl, _ := create("TestQueryWhereTypeMismatch", []string{"id"})
+	tbl.insert(0)
+	res, err := query("SELECT * FROM TestQueryWhereTypeMismatch WHERE id < 'one'")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(res.tuples))
+}
+
+func TestQueryWhereExpression(t *testing.T) {
+	tbl, _ := create(
+		"TestQueryWhereExpression", []string{"id", "name", "price"},
+	)
+	tbl.insert(0, "apple", 300)
+	tbl.insert(1, "orange", 130)
+	tbl.insert(2, "avocado", nil)
+	tbl.insert(3, "cabbage", 200)
+	res, err := query(
+		"SELECT id FROM TestQueryWhereExpression " +
+			"WHERE name LIKE 'a%' AND price IS NOT NULL " +
+			"OR price BETWEEN 100 AND 150 OR id IN (3, 4)",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(res.tuples))
+	assert.Equal(t, []interface{}{0}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{3}, res.tuples[2].values)
+}
+
+func TestQueryOrderBy(t *testing.T) {
+	tbl, _ := create("TestQueryOrderBy", []string{"id", "name"})
+	tbl.insert(0, "zero")
+	tbl.insert(1, "one")
+	tbl.insert(2, "two")
+	res, err := query("SELECT id FROM TestQueryOrderBy ORDER BY name")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{2}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{0}, res.tuples[2].values)
+}
+
+func TestQueryOrderByKeys(t *testing.T) {
+	tbl, _ := create("TestQueryOrderByKeys", []string{"id", "type_id", "price"})
+	tbl.insert(0, 2, 100)
+	tbl.insert(1, 1, 100)
+	tbl.insert(2, 2, 300)
+	tbl.insert(3, 1, nil)
+	res, err := query(
+		"SELECT id FROM TestQueryOrderByKeys " +
+			"ORDER BY type_id, price DESC NULLS FIRST",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(res.tuples))
+	assert.Equal(t, []interface{}{3}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{2}, res.tuples[2].values)
+	assert.Equal(t, []interface{}{0}, res.tuples[3].values)
+}
+
+func TestQueryLimit(t *testing.T) {
+	tbl, _ := create("TestQueryLimit", []string{"id", "price"})
+	tbl.insert(0, 300)
+	tbl.insert(1, 100)
+	tbl.insert(2, 200)
+	tbl.insert(3, 400)
+	res, err := query(
+		"SELECT id FROM TestQueryLimit ORDER BY price DESC LIMIT 2 OFFSET 1",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, []interface{}{0}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{2}, res.tuples[1].values)
+	res, err = query("SELECT id FROM TestQueryLimit LIMIT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{0}, res.tuples[0].values)
+}
+
+func TestQueryLeftJoin(t *testing.T) {
+	left, _ := create("TestQueryLeftJoinL", []string{"id", "name"})
+	left.insert(0, "zero")
+	left.insert(1, "one")
+	right, _ := create("TestQueryLeftJoinR", []string{"id", "size"})
+	right.insert(0, 100)
+	res, err := query(
+		"SELECT * FROM TestQueryLeftJoinL " +
+			"LEFT JOIN TestQueryLeftJoinR USING (id)",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(res.columns))
+	assert.Equal(t, []interface{}{0, "zero", 0, 100}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, "one", nil, nil}, res.tuples[1].values)
+}
+
+func TestQueryFullJoin(t *testing.T) {
+	left, _ := create("TestQueryFullJoinL", []string{"id", "name"})
+	left.insert(0, "zero")
+	left.insert(1, "one")
+	right, _ := create("TestQueryFullJoinR", []string{"id", "size"})
+	right.insert(0, 100)
+	right.insert(2, 200)
+	res, err := query(
+		"SELECT * FROM TestQueryFullJoinL " +
+			"FULL OUTER JOIN TestQueryFullJoinR USING (id)",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(res.tuples))
+	assert.Equal(t, []interface{}{0, "zero", 0, 100}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, "one", nil, nil}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{nil, nil, 2, 200}, res.tuples[2].values)
+}
+
+func TestQueryCrossJoin(t *testing.T) {
+	left, _ := create("TestQueryCrossJoinL", []string{"id"})
+	left.insert(0)
+	left.insert(1)
+	right, _ := create("TestQueryCrossJoinR", []string{"size"})
+	right.insert(100)
+	right.insert(200)
+	res, err := query(
+		"SELECT * FROM TestQueryCrossJoinL CROSS JOIN TestQueryCrossJoinR",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(res.tuples))
+	assert.Equal(t, []interface{}{1, 200}, res.tuples[3].values)
+}
+
+func TestQueryJoinOn(t *testing.T) {
+	left, _ := create("TestQueryJoinOnL", []string{"id", "type_id"})
+	left.insert(0, 10)
+	left.insert(1, 20)
+	right, _ := create("TestQueryJoinOnR", []string{"id", "name"})
+	right.insert(10, "ten")
+	res, err := query(
+		"SELECT TestQueryJoinOnL.id, name FROM TestQueryJoinOnL " +
+			"JOIN TestQueryJoinOnR " +
+			"ON TestQueryJoinOnR.id = TestQueryJoinOnL.type_id",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{0, "ten"}, res.tuples[0].values)
+}
+
+func TestQuerySubquery(t *testing.T) {
+	left, _ := create("TestQuerySubqueryL", []string{"id", "name"})
+	left.insert(0, "zero")
+	left.insert(1, "one")
+	right, _ := create("TestQuerySubqueryR", []string{"id", "size"})
+	right.insert(0, 100)
+	right.insert(1, 200)
+	res, err := query(
+		"SELECT * FROM (SELECT * FROM TestQuerySubqueryL WHERE id < 1) " +
+			"LEFT JOIN (SELECT * FROM TestQuerySubqueryR WHERE size = 200) " +
+			"USING (id)",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{0, "zero", nil, nil}, res.tuples[0].values)
+}
+
+func TestQueryUnknownTable(t *testing.T) {
+	_, err := query("SELECT * FROM TestQueryUnknownTable")
+	assert.Error(t, err)
+}
+
+func TestQuerySyntaxError(t *testing.T) {
+	_, err := query("SELECT * FROM")
+	assert.Error(t, err)
+}
+
+func TestExecCreate(t *testing.T) {
+	n, err := exec("CREATE TABLE TestExecCreate (id, name)")
+	defer drop("TestExecCreate")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	if assert.NotNil(t, tables["TestExecCreate"]) {
+		assert.Equal(t, []*column{
+			newColumn("", "id"), newColumn("", "name"),
+		}, tables["TestExecCreate"].columns)
+	}
+}
+
+func TestExecCreateTyped(t *testing.T) {
+	_, err := exec("CREATE TABLE TestExecCreateTyped (id INTEGER, name TEXT)")
+	defer drop("TestExecCreateTyped")
+	assert.NoError(t, err)
+	tbl := tables["TestExecCreateTyped"]
+	if assert.NotNil(t, tbl) {
+		assert.Equal(t, typeInteger, tbl.columns[0].typ)
+		assert.Equal(t, typeText, tbl.columns[1].typ)
+	}
+}
+
+func TestExecCreateDuplicateColumn(t *testing.T) {
+	_, err := exec("CREATE TABLE TestExecCreateDuplicateColumn (id, id)")
+	assert.Error(t, err)
+	assert.Nil(t, tables["TestExecCreateDuplicateColumn"])
+}
+
+func TestExecCreateExisting(t *testing.T) {
+	create("TestExecCreateExisting", []string{"id"})
+	_, err := exec("CREATE TABLE TestExecCreateExisting (id)")
+	assert.Error(t, err)
+}
+
+func TestExecCreateKeys(t *testing.T) {
+	_, err := exec("CREATE TABLE TestExecCreateKeys " +
+		"(a INTEGER, b INTEGER, PRIMARY KEY (a, b))")
+	defer drop("TestExecCreateKeys")
+	assert.NoError(t, err)
+	_, err = exec("INSERT INTO TestExecCreateKeys VALUES (0, 0), (0, 1)")
+	assert.NoError(t, err)
+	_, err = exec("INSERT INTO TestExecCreateKeys VALUES (1, 0), (0, 1)")
+	assert.IsType(t, &ErrConstraint{}, err)
+	_, err = exec("INSERT INTO TestExecCreateKeys VALUES (1, 0), (1, 0)")
+	assert.IsType(t, &ErrConstraint{}, err)
+	assert.Equal(t, 2, len(from("TestExecCreateKeys").tuples),
+		"it should insert no rows")
+}
+
+func TestExecCreateIndex(t *testing.T) {
+	tbl, _ := create("TestExecCreateIndex", []string{"id", "price"})
+	tbl.insert(0, 300)
+	tbl.insert(1, 130)
+	_, err := exec("CREATE INDEX TestExecCreateIndex_price " +
+		"ON TestExecCreateIndex (price)")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tbl.indexes))
+	r, err := query("SELECT id FROM TestExecCreateIndex WHERE price > 100")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 0}, ids(r))
+}
+
+func TestExecCreateIndexUnknownTable(t *testing.T) {
+	_, err := exec("CREATE INDEX TestExecCreateIndexUnknownTable ON none (id)")
+	assert.Error(t, err)
+}
+
+func TestExecInsert(t *testing.T) {
+	tbl, _ := create("TestExecInsert", []string{"id", "name"})
+	n, err := exec("INSERT INTO TestExecInsert VALUES (0, 'zero'), (1, 'one')")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []interface{}{0, "zero"}, from(tbl).tuples[0].values)
+	assert.Equal(t, []interface{}{1, "one"}, from(tbl).tuples[1].values)
+}
+
+func TestExecInsertColumns(t *testing.T) {
+	tbl, _ := create("TestExecInsertColumns", []string{"id", "name"})
+	n, err := exec("INSERT INTO TestExecInsertColumns (name) VALUES ('zero')")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []interface{}{nil, "zero"}, from(tbl).tuples[0].values)
+}
+
+func TestExecInsertUnknownColumn(t *testing.T) {
+	tbl, _ := create("TestExecInsertUnknownColumn", []string{"id"})
+	_, err := exec("INSERT INTO TestExecInsertUnknownColumn (name) VALUES (0)")
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(from(tbl).tuples))
+}
+
+func TestExecInsertTypeMismatch(t *testing.T) {
+	tbl, _ := createTable("TestExecInsertTypeMismatch", []columnDef{
+		{"id", typeInteger}, {"name", typeText},
+	})
+	_, err := exec(
+		"INSERT INTO TestExecInsertTypeMismatch VALUES (0, 'zero'), ('one', 1)",
+	)
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(from(tbl).tuples), "it should insert no rows")
+}
+
+func TestExecInsertArity(t *testing.T) {
+	tbl, _ := create("TestExecInsertArity", []string{"id", "name"})
+	_, err := exec("INSERT INTO TestExecInsertArity VALUES (0)")
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(from(tbl).tuples))
+}
+
+func TestExecInsertUnknownTable(t *testing.T) {
+	_, err := exec("INSERT INTO TestExecInsertUnknownTable VALUES (0)")
+	assert.Error(t, err)
+}
+
+func TestExecUpdate(t *testing.T) {
+	tbl, _ := create("TestExecUpdate", []string{"id", "name"})
+	tbl.insert(0, "zero")
+	tbl.insert(1, "one")
+	n, err := exec("UPDATE TestExecUpdate SET name = 'ONE' WHERE id = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []interface{}{0, "zero"}, from(tbl).tuples[0].values)
+	assert.Equal(t, []interface{}{1, "ONE"}, from(tbl).tuples[1].values)
+}
+
+func TestExecDelete(t *testing.T) {
+	tbl, _ := create("TestExecDelete", []string{"id", "name"})
+	tbl.insert(0, "zero")
+	tbl.insert(1, "one")
+	tbl.insert(2, "two")
+	n, err := exec("DELETE FROM TestExecDelete WHERE id < 2")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 1, len(from(tbl).tuples))
+	assert.Equal(t, []interface{}{2, "two"}, from(tbl).tuples[0].values)
+}
+
+func TestExecDrop(t *testing.T) {
+	create("TestExecDrop", []string{"id"})
+	_, err := exec("DROP TABLE TestExecDrop")
+	assert.NoError(t, err)
+	assert.Nil(t, tables["TestExecDrop"])
+}
+
+func TestExecDropUnknown(t *testing.T) {
+	_, err := exec("DROP TABLE TestExecDropUnknown")
+	assert.Error(t, err)
+}
+
+func TestExecQuery(t *testing.T) {
+	create("TestExecQuery", []string{"id"})
+	_, err := exec("SELECT * FROM TestExecQuery")
+	assert.Error(t, err)
+}
+
+func TestQueryGroupBy(t *testing.T) {
+	tbl, _ := create("TestQueryGroupBy", []string{"id", "type", "price"})
+	tbl.insert(0, 1, 100)
+	tbl.insert(1, 2, 200)
+	tbl.insert(2, 1, 300)
+	res, err := query(
+		"SELECT type, AVG(price) FROM TestQueryGroupBy " +
+			"GROUP BY type ORDER BY type",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, []interface{}{1, 200.0}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{2, 200.0}, res.tuples[1].values)
+}
+
+func TestQueryOrderByAggregate(t *testing.T) {
+	tbl, _ := create("TestQueryOrderByAggregate", []string{"id", "type"})
+	defer drop("TestQueryOrderByAggregate")
+	tbl.insert(0, 1)
+	tbl.insert(1, 2)
+	tbl.insert(2, 2)
+	res, err := query("SELECT type FROM TestQueryOrderByAggregate " +
+		"GROUP BY type ORDER BY COUNT(*) DESC")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{2, 1}, ids(res))
+}
+
+func TestQueryAggregateWhole(t *testing.T) {
+	tbl, _ := create("TestQueryAggregateWhole", []string{"id"})
+	tbl.insert(0)
+	tbl.insert(1)
+	res, err := query("SELECT COUNT(*) FROM TestQueryAggregateWhole")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{2}, res.tuples[0].values)
+}
+
+func TestQueryGroupByUngrouped(t *testing.T) {
+	create("TestQueryGroupByUngrouped", []string{"id", "type"})
+	_, err := query("SELECT id FROM TestQueryGroupByUngrouped GROUP BY type")
+	assert.Error(t, err)
+}
+
+func TestQueryGroupByQualified(t *testing.T) {
+	tbl, _ := create("TestQueryGroupByQualified", []string{"id", "type"})
+	defer drop("TestQueryGroupByQualified")
+	tbl.insert(0, 1)
+	tbl.insert(1, 1)
+	for _, src := range []string{
+		"SELECT TestQueryGroupByQualified.type, COUNT(*) " +
+			"FROM TestQueryGroupByQualified GROUP BY type",
+		"SELECT type, COUNT(*) FROM TestQueryGroupByQualified " +
+			"GROUP BY TestQueryGroupByQualified.type",
+	} {
+		res, err := query(src)
+		if assert.NoError(t, err, src) {
+			assert.Equal(t, []interface{}{1, 2}, res.tuples[0].values)
+		}
+	}
+}
+
+func TestQueryGroupByStar(t *testing.T) {
+	create("TestQueryGroupByStar", []string{"id", "type"})
+	_, err := query("SELECT * FROM TestQueryGroupByStar GROUP BY type")
+	assert.Error(t, err)
+}
+
+func TestQuerySumStar(t *testing.T) {
+	create("TestQuerySumStar", []string{"id"})
+	_, err := query("SELECT SUM(*) FROM TestQuerySumStar")
+	assert.Error(t, err)
+}
+
+func TestQueryGroupByHaving(t *testing.T) {
+	tbl, _ := create(
+		"TestQueryGroupByHaving", []string{"id", "type", "supplier", "price"},
+	)
+	tbl.insert(0, 1, "a", 100)
+	tbl.insert(1, 1, "b", 200)
+	tbl.insert(2, 1, "a", 300)
+	tbl.insert(3, 2, "a", 400)
+	res, err := query(
+		"SELECT type, supplier, SUM(price) FROM TestQueryGroupByHaving " +
+			"GROUP BY type, supplier HAVING COUNT(*) < 2 ORDER BY supplier",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(res.columns))
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, []interface{}{2, "a", 400}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, "b", 200}, res.tuples[1].values)
+}
+
+func TestQueryHavingUngrouped(t *testing.T) {
+	create("TestQueryHavingUngrouped", []string{"id", "type"})
+	_, err := query(
+		"SELECT type FROM TestQueryHavingUngrouped GROUP BY type HAVING id = 1",
+	)
+	assert.Error(t, err)
+}
+
+func TestQueryHavingWithoutGroupBy(t *testing.T) {
+	create("TestQueryHavingWithoutGroupBy", []string{"id"})
+	_, err := query("SELECT id FROM TestQueryHavingWithoutGroupBy HAVING id = 1")
+	assert.Error(t, err)
+}
+
+func TestQueryUnknownColumn(t *testing.T) {
+	create("TestQueryUnknownColumn", []string{"id", "price"})
+	_, err := query("SELECT prise FROM TestQueryUnknownColumn")
+	assert.Equal(t, &ErrUnknownColumn{
+		Name: "prise", Available: []string{"id", "price"},
+	}, err)
+}
+
+func TestQueryUnknownColumnInWhere(t *testing.T) {
+	create("TestQueryUnknownColumnInWhere", []string{"id"})
+	_, err := query("SELECT * FROM TestQueryUnknownColumnInWhere WHERE x = 1")
+	assert.IsType(t, &ErrUnknownColumn{}, err)
+}
+
+func TestExecDeleteUnknownColumn(t *testing.T) {
+	tbl, _ := create("TestExecDeleteUnknownColumn", []string{"id"})
+	tbl.insert(0)
+	_, err := exec("DELETE FROM TestExecDeleteUnknownColumn WHERE x = 0")
+	assert.IsType(t, &ErrUnknownColumn{}, err)
+	assert.Equal(t, 1, len(from(tbl).tuples))
+}
+
+func TestExecCreateForeignKeys(t *testing.T) {
+	withCatalog(func() {
+		_, err := exec("CREATE TABLE types (type_id INTEGER PRIMARY KEY)")
+		assert.NoError(t, err)
+		_, err = exec("CREATE TABLE items (id INTEGER, type_id INTEGER, " +
+			"FOREIGN KEY (type_id) REFERENCES types ON DELETE CASCADE)")
+		assert.NoError(t, err)
+		exec("INSERT INTO types VALUES (1), (2)")
+		_, err = exec("INSERT INTO items VALUES (0, 1), (1, 3)")
+		assert.IsType(t, &ErrConstraint{}, err)
+		exec("INSERT INTO items VALUES (0, 1), (1, 2)")
+		n, err := exec("DELETE FROM types WHERE type_id = 1")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []interface{}{1}, ids(from("items")))
+		_, err = exec("DROP TABLE types")
+		assert.IsType(t, &ErrConstraint{}, err, "items should reference types")
+	})
+}
+
+func TestExecInsertSelfReferences(t *testing.T) {
+	withCatalog(func() {
+		exec("CREATE TABLE e (id INTEGER PRIMARY KEY, boss INTEGER REFERENCES e)")
+		n, err := exec("INSERT INTO e VALUES (10, NULL), (11, 12), (12, NULL)")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+		assert.Equal(t, []interface{}{10, 11, 12}, ids(from("e")))
+		_, err = exec("INSERT INTO e VALUES (13, 14), (14, 15)")
+		assert.IsType(t, &ErrConstraint{}, err)
+		assert.Equal(t, 3, len(from("e").tuples), "it should insert no rows")
+	})
+}
+
+func TestExecCreateChecks(t *testing.T) {
+	_, err := exec("CREATE TABLE TestExecCreateChecks (id INTEGER, " +
+		"name TEXT NOT NULL DEFAULT 'unknown', price INTEGER CHECK (price > 0))")
+	defer drop("TestExecCreateChecks")
+	assert.NoError(t, err)
+	_, err = exec("INSERT INTO TestExecCreateChecks (id, price) VALUES (0, 100)")
+	assert.NoError(t, err)
+	_, err = exec("INSERT INTO TestExecCreateChecks VALUES (1, NULL, 100)")
+	assert.IsType(t, &ErrConstraint{}, err)
+	_, err = exec("INSERT INTO TestExecCreateChecks (id, price) " +
+		"VALUES (1, 100), (2, 0)")
+	if assert.IsType(t, &ErrConstraint{}, err) {
+		assert.Equal(t, "TestExecCreateChecks_price_check",
+			err.(*ErrConstraint).Constraint)
+	}
+	r := from("TestExecCreateChecks")
+	if assert.Equal(t, 1, len(r.tuples), "it should insert no rows") {
+		assert.Equal(t, []interface{}{0, "unknown", 100}, r.tuples[0].values)
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// evaluator computes the value of an expression for a tuple
+type evaluator func(t *tuple) interface{}
+
+// expr is a node of expression trees. compile resolves
+// the column references against the relation in advance,
+// so that the evaluator never fails for each tuple.
+// predicates follow the three-valued logic of SQL,
+// where nil stands for UNKNOWN as well as NULL
+type expr interface {
+	compile(r *relation) (evaluator, error)
+}
+
+type colRef struct {
+	name string
+}
+
+func ref(name string) *colRef {
+	return &colRef{name: name}
+}
+
+func (e *colRef) compile(r *relation) (evaluator, error) {
+	idx, err := r.lookupColumn(e.name)
+	if err != nil {
+		return nil, err
+	}
+	return func(t *tuple) interface{} {
+		return t.values[idx]
+	}, nil
+}
+
+type literal struct {
+	value interface{}
+}
+
+func lit(v interface{}) *literal {
+	return &literal{value: v}
+}
+
+func (e *literal) compile(r *relation) (evaluator, error) {
+	return func(t *tuple) interface{} {
+		return e.value
+	}, nil
+}
+
+type comparison struct {
+	op          string
+	left, right expr
+}
+
+func eq(l, r expr) *comparison { return &comparison{"=", l, r} }
+func ne(l, r expr) *comparison { return &comparison{"<>", l, r} }
+func lt(l, r expr) *comparison { return &comparison{"<", l, r} }
+func le(l, r expr) *comparison { return &comparison{"<=", l, r} }
+func gt(l, r expr) *comparison { return &comparison{">", l, r} }
+func ge(l, r expr) *comparison { return &comparison{">=", l, r} }
+
+func (e *comparison) compile(r *relation) (evaluator, error) {
+	var test func(c int) bool
+	switch e.op {
+	case "=":
+		test = func(c int) bool { return c == 0 }
+	case "<>", "!=":
+		test = func(c int) bool { return c != 0 }
+	case "<":
+		test = func(c int) bool { return c < 0 }
+	case "<=":
+		test = func(c int) bool { return c <= 0 }
+	case ">":
+		test = func(c int) bool { return c > 0 }
+	case ">=":
+		test = func(c int) bool { return c >= 0 }
+	default:
+		return nil, fmt.Errorf("unknown operator: %s", e.op)
+	}
+	l, err := e.left.compile(r)
+	if err != nil {
+		return nil, err
+	}
+	rt, err := e.right.compile(r)
+	if err != nil {
+		return nil, err
+	}
+	return func(t *tuple) interface{} {
+		lv, rv := l(t), rt(t)
+		if lv == nil || rv == nil {
+			return nil
+		}
+		c, ok := compareValues(lv, rv)
+		if !ok {
+			// values of different types are just unequal
+			return e.op == "<>" || e.op == "!="
+		}
+		return test(c)
+	}, nil
+}
+
+type andExpr struct {
+	operands []expr
+}
+
+func and(es ...expr) *andExpr {
+	return &andExpr{operands: es}
+}
+
+func (e *andExpr) compile(r *relation) (evaluator, error) {
+	fs, err := compileAll(r, e.operands)
+	if err != nil {
+		return nil, err
+	}
+	return func(t *tuple) interface{} {
+		var res interface{} = true
+		for _, f := range fs {
+			switch v := f(t); {
+			case v == nil:
+				res = nil
+			case !isTrue(v):
+				return false
+			}
+		}
+		return res
+	}, nil
+}
+
+type orExpr struct {
+	operands []expr
+}
+
+func or(es ...expr) *orExpr {
+	return &orExpr{operands: es}
+}
+
+func (e *orExpr) compile(r *relation) (evaluator, error) {
+	fs, err := compileAll(r, e.operands)
+	if err != nil {
+		return nil, err
+	}
+	return func(t *tuple) interface{} {
+		var res interface{} = false
+		for _, f := range fs {
+			switch v := f(t); {
+			case v == nil:
+				res = nil
+			case isTrue(v):
+				return true
+			}
+		}
+		return res
+	}, nil
+}
+
+type notExpr struct {
+	operand expr
+}
+
+func not(e expr) *notExpr {
+	return &notExpr{operand: e}
+}
+
+func (e *notExpr) compile(r *relation) (evaluator, error) {
+	f, err := e.operand.compile(r)
+	if err != nil {
+		return nil, err
+	}
+	return func(t *tuple) interface{} {
+		return negate(f(t))
+	}, nil
+}
+
+type isNullExpr struct {
+	operand expr
+	negated bool
+}
+
+func isNull(e expr) *isNullExpr {
+	return &isNullExpr{operand: e}
+}
+
+func isNotNull(e expr) *isNullExpr {
+	return &isNullExpr{operand: e, negated: true}
+}
+
+func (e *isNullExpr) compile(r *relation) (evaluator, error) {
+	f, err := e.operand.compile(r)
+	if err != nil {
+		return nil, err
+	}
+	return func(t *tuple) interface{} {
+		return (f(t) == nil) != e.negated
+	}, nil
+}
+
+type inExpr struct {
+	operand expr
+	list    []expr
+	negated bool
+}
+
+func in(e expr, list ...expr) *inExpr {
+	return &inExpr{operand: e, list: list}
+}
+
+func (e *inExpr) compile(r *relation) (evaluator, error) {
+	f, err := e.operand.compile(r)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := compileAll(r, e.list)
+	if err != nil {
+		return nil, err
+	}
+	// x IN (a, b) is the same as x = a OR x = b
+	return func(t *tuple) interface{} {
+		v := f(t)
+		if v == nil {
+			return nil
+		}
+		var res interface{} = false
+		for _, g := range fs {
+			w := g(t)
+			if w == nil {
+				res = nil
+				continue
+			}
+			if c, ok := compareValues(v, w); ok && c == 0 {
+				res = true
+				break
+			}
+		}
+		if e.negated {
+			return negate(res)
+		}
+		return res
+	}, nil
+}
+
+type betweenExpr struct {
+	operand expr
+	low     expr
+	high    expr
+	negated bool
+}
+
+func between(e, low, high expr) *betweenExpr {
+	return &betweenExpr{operand: e, low: low, high: high}
+}
+
+func (e *betweenExpr) compile(r *relation) (evaluator, error) {
+	fs, err := compileAll(r, []expr{e.operand, e.low, e.high})
+	if err != nil {
+		return nil, err
+	}
+	return func(t *tuple) interface{} {
+		v, low, high := fs[0](t), fs[1](t), fs[2](t)
+		if v == nil || low == nil || high == nil {
+			return nil
+		}
+		lo, ok1 := compareValues(low, v)
+		hi, ok2 := compareValues(v, high)
+		if !ok1 || !ok2 {
+			return e.negated
+		}
+		return (lo <= 0 && hi <= 0) != e.negated
+	}, nil
+}
+
+// likeExpr matches strings against patterns,
+// in which % matches any sequence and _ matches any single character
+type likeExpr struct {
+	operand expr
+	pattern expr
+	negated bool
+}
+
+func like(e, pattern expr) *likeExpr {
+	return &likeExpr{operand: e, pattern: pattern}
+}
+
+func (e *likeExpr) compile(r *relation) (evaluator, error) {
+	f, err := e.operand.compile(r)
+	if err != nil {
+		return nil, err
+	}
+	p, err := e.pattern.compile(r)
+	if err != nil {
+		return nil, err
+	}
+	return func(t *tuple) interface{} {
+		v, w := f(t), p(t)
+		if v == nil || w == nil {
+			return nil
+		}
+		s, ok1 := v.(string)
+		pat, ok2 := w.(string)
+		if !ok1 || !ok2 {
+			return e.negated
+		}
+		return matchLike(s, pat) != e.negated
+	}, nil
+}
+
+func matchLike(s, pat string) bool {
+	return matchRunes([]rune(s), []rune(pat))
+}
+
+// matchRunes matches s to pat from the left, going back to the last %
+// on a mismatch to let it take one more rune. the earlier % need not
+// be retried, since the later one can take whatever they would
+func matchRunes(s, pat []rune) bool {
+	i, j := 0, 0
+	star, next := -1, 0
+	for i < len(s) {
+		switch {
+		case j < len(pat) && pat[j] == '%':
+			star, next = j, i
+			j++
+		case j < len(pat) && (pat[j] == '_' || pat[j] == s[i]):
+			i++
+			j++
+		case star >= 0:
+			next++
+			i, j = next, star+1
+		default:
+			return false
+		}
+	}
+	for j < len(pat) && pat[j] == '%' {
+		j++
+	}
+	return j == len(pat)
+}
+
+// callExpr calls a scalar function, CURRENT_TIMESTAMP or NEXTVAL,
+// which is resolved by the name when compiled
+type callExpr struct {
+	name string
+	args []expr
+}
+
+func call(name string, args ...expr) *callExpr {
+	return &callExpr{name: name, args: args}
+}
+
+// timestamps are the text of the time in UTC, which sorts as the time
+const timestampLayout = "2006-01-02 15:04:05"
+
+// now is the clock of CURRENT_TIMESTAMP, which the tests replace
+var now = time.Now
+
+func (e *callExpr) compile(r *relation) (evaluator, error) {
+	fs, err := compileAll(r, e.args)
+	if err != nil {
+		return nil, err
+	}
+	switch e.name {
+	case "CURRENT_TIMESTAMP":
+		if len(fs) != 0 {
+			return nil, fmt.Errorf("%s takes no arguments", e.name)
+		}
+		return func(t *tuple) interface{} {
+			return now().UTC().Format(timestampLayout)
+		}, nil
+	case "NEXTVAL":
+		// the sequence is named by a literal, resolved in advance
+		name := ""
+		if len(e.args) == 1 {
+			if l, ok := e.args[0].(*literal); ok {
+				name, _ = l.value.(string)
+			}
+		}
+		s := findSequence(name)
+		if s == nil {
+			return nil, fmt.Errorf("%s: unknown sequence: %q", e.name, name)
+		}
+		return func(t *tuple) interface{} {
+			return s.nextValue()
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown function: %s", e.name)
+}
+
+func compileAll(r *relation, es []expr) ([]evaluator, error) {
+	fs := []evaluator{}
+	for _, e := range es {
+		f, err := e.compile(r)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+func isTrue(v interface{}) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// negate is NOT of the three-valued logic, where NOT UNKNOWN is UNKNOWN
+func negate(v interface{}) interface{} {
+	if b, ok := v.(bool); ok {
+		return !b
+	}
+	return nil
+}
+
+// where keeps the tuples for which the predicate is true,
+// dropping those for which it is false or UNKNOWN.
+// if the predicate restricts an indexed column to a range,
+// only the tuples in the range are tested, in order of the column
+func (r *relation) where(e expr) *relation {
+	if r.err != nil {
+		return r
+	}
+	f, err := e.compile(r)
+	if err != nil {
+		return r.fail(err)
+	}
+	if ix, kr, ok := r.indexedRange(e); ok {
+		r = r.indexed(ix, kr)
+		if r.err != nil {
+			return r
+		}
+	}
+	return r.filter(func(tup *tuple) bool {
+		return isTrue(f(tup))
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func exprRelation() *relation {
+	return &relation{
+		columns: []*column{
+			newColumn("", "id"), newColumn("", "name"), newColumn("", "price"),
+		},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{0, "apple", 300}},
+			&tuple{values: []interface{}{1, "orange", 130.5}},
+			&tuple{values: []interface{}{2, "avocado", nil}},
+			&tuple{values: []interface{}{3, "cabbage", 200}},
+		},
+	}
+}
+
+func ids(r *relation) []interface{} {
+	res := []interface{}{}
+	for _, tup := range r.load().tuples {
+		res = append(res, tup.values[0])
+	}
+	return res
+}
+
+func TestWhereUnknown(t *testing.T) {
+	res := exprRelation().where(eq(ref("unknown"), lit(0)))
+	assert.IsType(t, &ErrUnknownColumn{}, res.err)
+	assert.Equal(t, 0, len(res.tuples))
+}
+
+func TestWherePropagated(t *testing.T) {
+	res := from("TestWherePropagated").where(eq(ref("id"), lit(0)))
+	assert.IsType(t, &ErrUnknownTable{}, res.err)
+}
+
+func TestWhereComparisons(t *testing.T) {
+	cases := []struct {
+		in  expr
+		out []interface{}
+	}{
+		{eq(ref("name"), lit("apple")), []interface{}{0}},
+		{ne(ref("name"), lit("apple")), []interface{}{1, 2, 3}},
+		{lt(ref("price"), lit(200)), []interface{}{1}},
+		{le(ref("price"), lit(200)), []interface{}{1, 3}},
+		{gt(ref("price"), lit(200)), []interface{}{0}},
+		{ge(ref("price"), lit(200.0)), []interface{}{0, 3}},
+		{lt(ref("id"), ref("price")), []interface{}{0, 1, 3}},
+		{eq(ref("price"), lit("300")), []interface{}{}},
+		{ne(ref("price"), lit("300")), []interface{}{0, 1, 3}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.out, ids(exprRelation().where(c.in)), "%#v", c.in)
+	}
+}
+
+func TestWhereLogical(t *testing.T) {
+	cases := []struct {
+		in  expr
+		out []interface{}
+	}{
+		{and(gt(ref("id"), lit(0)), lt(ref("id"), lit(3))), []interface{}{1, 2}},
+		{or(eq(ref("id"), lit(0)), eq(ref("id"), lit(3))), []interface{}{0, 3}},
+		{not(eq(ref("id"), lit(0))), []interface{}{1, 2, 3}},
+		{and(), []interface{}{0, 1, 2, 3}},
+		{or(), []interface{}{}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.out, ids(exprRelation().where(c.in)), "%#v", c.in)
+	}
+}
+
+func TestWherePredicates(t *testing.T) {
+	cases := []struct {
+		in  expr
+		out []interface{}
+	}{
+		{isNull(ref("price")), []interface{}{2}},
+		{isNotNull(ref("price")), []interface{}{0, 1, 3}},
+		{in(ref("name"), lit("apple"), lit("cabbage")), []interface{}{0, 3}},
+		{&inExpr{ref("id"), []expr{lit(0), lit(1)}, true}, []interface{}{2, 3}},
+		{between(ref("price"), lit(130), lit(200)), []interface{}{1, 3}},
+		{&betweenExpr{ref("price"), lit(130), lit(200), true},
+			[]interface{}{0}},
+		{like(ref("name"), lit("a%")), []interface{}{0, 2}},
+		{like(ref("name"), lit("_a%")), []interface{}{3}},
+		{&likeExpr{ref("name"), lit("%e"), true}, []interface{}{2}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.out, ids(exprRelation().where(c.in)), "%#v", c.in)
+	}
+}
+
+func TestMatchLike(t *testing.T) {
+	cases := []struct {
+		s, pat string
+		out    bool
+	}{
+		{"", "", true},
+		{"", "%", true},
+		{"a", "", false},
+		{"apple", "apple", true},
+		{"apple", "a%", true},
+		{"apple", "%le", true},
+		{"apple", "%p%", true},
+		{"apple", "a_ple", true},
+		{"apple", "a__le", true},
+		{"apple", "_", false},
+		{"apple", "%%%", true},
+		{"りんご", "り_ご", true},
+		{"apple", "A%", false},
+		{"banana", "%a_a", true},
+		{"abcab", "%ab", true},
+		{"abcb", "%ab", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.out, matchLike(c.s, c.pat), "%q %q", c.s, c.pat)
+	}
+}
+
+func TestMatchLikeBacktracking(t *testing.T) {
+	s := strings.Repeat("a", 10000)
+	assert.False(t, matchLike(s, "%a%a%a%a%a%a%a%a%b"))
+	assert.True(t, matchLike(s+"b", "%a%a%a%a%a%a%a%a%b"))
+}
+
+func TestWhereUnknownIsNotTrue(t *testing.T) {
+	cases := []struct {
+		in  expr
+		out []interface{}
+	}{
+		{not(lt(ref("price"), lit(200))), []interface{}{0, 3}},
+		{not(eq(ref("price"), lit(nil))), []interface{}{}},
+		{or(lt(ref("price"), lit(200)), eq(ref("id"), lit(2))),
+			[]interface{}{1, 2}},
+		{not(or(lt(ref("price"), lit(200)), eq(ref("id"), lit(0)))),
+			[]interface{}{3}},
+		{not(and(lt(ref("price"), lit(250)), eq(ref("id"), lit(2)))),
+			[]interface{}{0, 1, 3}},
+		{not(in(ref("price"), lit(300), lit(nil))), []interface{}{}},
+		{&inExpr{ref("id"), []expr{lit(0), lit(nil)}, true}, []interface{}{}},
+		{not(between(ref("price"), lit(100), lit(nil))), []interface{}{}},
+		{not(like(ref("name"), lit(nil))), []interface{}{}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.out, ids(exprRelation().where(c.in)), "%#v", c.in)
+	}
+}
+
+func TestThreeValuedLogic(t *testing.T) {
+	r := &relation{columns: []*column{}, tuples: []*tuple{}}
+	u, tr, fa := lit(nil), lit(true), lit(false)
+	cases := []struct {
+		in  expr
+		out interface{}
+	}{
+		{and(tr, u), nil}, {and(fa, u), false}, {and(tr, tr), true},
+		{or(tr, u), true}, {or(fa, u), nil}, {or(fa, fa), false},
+		{not(u), nil}, {not(tr), false},
+		{eq(u, u), nil}, {lt(lit(1), u), nil},
+		{in(lit(1), lit(2), u), nil}, {in(lit(1), u, lit(1)), true},
+		{in(u, lit(1)), nil},
+		{isNull(u), true}, {isNotNull(u), false},
+	}
+	for _, c := range cases {
+		f, err := c.in.compile(r)
+		if assert.NoError(t, err) {
+			assert.Equal(t, c.out, f(&tuple{}), "%#v", c.in)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// fkAction is what deleting a referenced row does to the rows referencing it
+type fkAction int
+
+const (
+	// restrictAction rejects the deletion
+	restrictAction fkAction = iota
+	// cascadeAction deletes the referencing rows too
+	cascadeAction
+	// setNullAction sets the referencing columns to NULL
+	setNullAction
+)
+
+var fkActionNames = []string{"RESTRICT", "CASCADE", "SET NULL"}
+
+func (a fkAction) String() string {
+	return fkActionNames[a]
+}
+
+// foreignKeyDef declares that the values of the columns are those
+// of the referenced columns in the referenced table, which must be
+// a key of it. no referenced columns mean its primary key
+type foreignKeyDef struct {
+	columns    []string
+	refTable   string
+	refColumns []string
+	onDelete   fkAction
+}
+
+// references declares a foreign key of the columns referencing the table
+func references(
+	colNames []string, refTable string, refColNames ...string,
+) foreignKeyDef {
+	return foreignKeyDef{
+		columns: colNames, refTable: refTable, refColumns: refColNames,
+	}
+}
+
+// onDeleteDo returns fk with the action on deleting the referenced rows
+func (fk foreignKeyDef) onDeleteDo(a fkAction) foreignKeyDef {
+	fk.onDelete = a
+	return fk
+}
+
+// foreignKey is a FOREIGN KEY constraint. the referenced table is
+// looked up by the name whenever it is checked, as it may be loaded
+// after the referencing one. the rows with NULLs in the columns
+// reference nothing, and are not checked
+type foreignKey struct {
+	name       string
+	columns    []int
+	refTable   string
+	refColumns []string
+	onDelete   fkAction
+}
+
+func (fk foreignKeyDef) addTo(t *table) error {
+	idxs := []int{}
+	for _, cn := range fk.columns {
+		idx, err := t.lookupColumn(cn)
+		if err != nil {
+			return err
+		}
+		idxs = append(idxs, idx)
+	}
+	// a table may reference itself, before it is registered
+	ref := t
+	if fk.refTable != t.name {
+		var err error
+		if ref, err = lookupTable(fk.refTable); err != nil {
+			return err
+		}
+	}
+	refCols := fk.refColumns
+	if refCols == nil {
+		pk := ref.primaryKey()
+		if pk == nil {
+			return fmt.Errorf("%s: no primary key to reference", ref.name)
+		}
+		for _, idx := range pk.columns {
+			refCols = append(refCols, ref.columns[idx].name)
+		}
+	}
+	if len(idxs) == 0 || len(idxs) != len(refCols) {
+		return fmt.Errorf(
+			"%s: %d columns referencing %d columns",
+			t.name, len(idxs), len(refCols),
+		)
+	}
+	if ref.keyOn(refCols) == nil {
+		return fmt.Errorf(
+			"%s: no key on (%s)", ref.name, strings.Join(refCols, ", "),
+		)
+	}
+	t.foreignKeys = append(t.foreignKeys, &foreignKey{
+		name:       foreignKeyName(t.name, fk.columns),
+		columns:    idxs,
+		refTable:   fk.refTable,
+		refColumns: refCols,
+		onDelete:   fk.onDelete,
+	})
+	return nil
+}
+
+func foreignKeyName(tblName string, colNames []string) string {
+	return tblName + "_" + strings.Join(colNames, "_") + "_fkey"
+}
+
+// keyOn returns the key of t on the columns in the order, or nil if none
+func (t *table) keyOn(colNames []string) *uniqueKey {
+	for _, k := range t.keys {
+		if len(k.columns) != len(colNames) {
+			continue
+		}
+		match := true
+		for i, idx := range k.columns {
+			match = match && t.columns[idx].name == colNames[i]
+		}
+		if match {
+			return k
+		}
+	}
+	return nil
+}
+
+// target returns the referenced table and its key
+func (fk *foreignKey) target() (*table, *uniqueKey, error) {
+	ref, err := lookupTable(fk.refTable)
+	if err != nil {
+		return nil, nil, err
+	}
+	k := ref.keyOn(fk.refColumns)
+	if k == nil {
+		return nil, nil, fmt.Errorf(
+			"%s: no key on (%s)", ref.name, strings.Join(fk.refColumns, ", "),
+		)
+	}
+	return ref, k, nil
+}
+
+// checkForeignKeys checks that the rows to be stored in t reference
+// the rows in the referenced tables. a row of a table referencing itself
+// may reference one of the rows stored with it
+func (t *table) checkForeignKeys(rows [][]interface{}) error {
+	for _, fk := range t.foreignKeys {
+		ref, k, err := fk.target()
+		if err != nil {
+			return err
+		}
+		own := map[string]bool{}
+		if ref == t {
+			for _, row := range rows {
+				if key := k.index.key(row); key != nil {
+					own[hashKey(key)] = true
+				}
+			}
+		}
+		for _, row := range rows {
+			key := valuesAt(row, fk.columns)
+			if key == nil || own[hashKey(key)] || len(k.index.lookup(key)) > 0 {
+				continue
+			}
+			return &ErrConstraint{t.name, fk.name, fmt.Sprintf(
+				"(%s)=(%s) is not in %s",
+				strings.Join(fk.refColumns, ", "), formatValues(key), ref.name,
+			)}
+		}
+	}
+	return nil
+}
+
+// reference is a foreign key of a table referencing another
+type reference struct {
+	from *table
+	fk   *foreignKey
+}
+
+// referencing returns the foreign keys referencing t, in order of the tables
+func (t *table) referencing() []reference {
+	names := []string{}
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	refs := []reference{}
+	for _, name := range names {
+		for _, fk := range tables[name].foreignKeys {
+			if fk.refTable == t.name {
+				refs = append(refs, reference{tables[name], fk})
+			}
+		}
+	}
+	return refs
+}
+
+// referencingRows returns the rows of ref.from referencing the tuple of t
+func (t *table) referencingRows(ref reference, tup *tuple) ([]*tuple, error) {
+	k := t.keyOn(ref.fk.refColumns)
+	if k == nil {
+		return nil, nil
+	}
+	key := valuesAt(tup.values, k.columns)
+	if key == nil {
+		return []*tuple{}, nil
+	}
+	return ref.from.findRows(ref.fk.columns, key)
+}
+
+// checkReferenced checks that the rows, which replace the current tuples,
+// do not change the keys referenced by other rows
+func (t *table) checkReferenced(curs []*tuple, rows [][]interface{}) error {
+	for _, ref := range t.referencing() {
+		k := t.keyOn(ref.fk.refColumns)
+		for i, cur := range curs {
+			old := valuesAt(cur.values, k.columns)
+			new := valuesAt(rows[i], k.columns)
+			if old == nil || new != nil && hashKey(old) == hashKey(new) {
+				continue
+			}
+			tups, err := t.referencingRows(ref, cur)
+			if err != nil {
+				return err
+			}
+			if len(tups) > 0 {
+				return &ErrConstraint{ref.from.name, ref.fk.name, fmt.Sprintf(
+					"(%s)=(%s) is referenced",
+					strings.Join(ref.fk.refColumns, ", "), formatValues(old),
+				)}
+			}
+		}
+	}
+	return nil
+}
+
+// checkDelete checks the actions of the foreign keys on deleting
+// the tuples of t, following the cascades, before any row is deleted.
+// deleting collects the rows to be deleted by the cascades,
+// which do not restrict the deletion
+func (t *table) checkDelete(
+	curs []*tuple, deleting map[*table]map[rowID]bool,
+) error {
+	if deleting[t] == nil {
+		deleting[t] = map[rowID]bool{}
+	}
+	for _, cur := range curs {
+		deleting[t][cur.rid] = true
+	}
+	for _, ref := range t.referencing() {
+		for _, cur := range curs {
+			tups, err := t.referencingRows(ref, cur)
+			if err != nil {
+				return err
+			}
+			rest := []*tuple{}
+			for _, tup := range tups {
+				if !deleting[ref.from][tup.rid] {
+					rest = append(rest, tup)
+				}
+			}
+			if len(rest) == 0 {
+				continue
+			}
+			switch ref.fk.onDelete {
+			case restrictAction:
+				return &ErrConstraint{ref.from.name, ref.fk.name, fmt.Sprintf(
+					"%d rows reference the row of %s", len(rest), t.name,
+				)}
+			case cascadeAction:
+				if err := ref.from.checkDelete(rest, deleting); err != nil {
+					return err
+				}
+			case setNullAction:
+				rows := [][]interface{}{}
+				for _, tup := range rest {
+					rows = append(rows, ref.fk.nulled(tup.values))
+				}
+				if err := ref.from.check(rest, rows); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasDeleteActions reports whether deleting the rows of t
+// may delete or update the rows referencing them
+func (t *table) hasDeleteActions() bool {
+	for _, ref := range t.referencing() {
+		if ref.fk.onDelete != restrictAction {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDeleteActions applies the actions of the foreign keys
+// referencing the deleted tuples of t
+func (t *table) applyDeleteActions(curs []*tuple) error {
+	for _, ref := range t.referencing() {
+		if ref.fk.onDelete == restrictAction {
+			continue
+		}
+		for _, cur := range curs {
+			tups, err := t.referencingRows(ref, cur)
+			if err != nil {
+				return err
+			}
+			if ref.fk.onDelete == cascadeAction {
+				_, err = ref.from.delete(tups)
+			} else {
+				set := map[string]interface{}{}
+				for _, idx := range ref.fk.columns {
+					set[ref.from.columns[idx].name] = nil
+				}
+				_, err = ref.from.update(tups, set)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nulled returns a copy of the values whose referencing columns are NULL
+func (fk *foreignKey) nulled(vals []interface{}) []interface{} {
+	row := append([]interface{}{}, vals...)
+	for _, idx := range fk.columns {
+		row[idx] = nil
+	}
+	return row
+}
+
+// findRows returns the rows of t whose values of the columns are the key,
+// by an index on the columns or the storage if any
+func (t *table) findRows(cols []int, key []interface{}) ([]*tuple, error) {
+	for _, ix := range t.indexes {
+		if ix.kind == hashIndex && equalInts(ix.columns, cols) {
+			return t.fetchAll(ix.lookup(key))
+		}
+	}
+	if len(cols) == 1 {
+		if ix := t.indexOn(cols[0], true); ix != nil {
+			return t.fetchAll(ix.find(pointRange(key[0])))
+		}
+		if is, ok := t.store.(indexedStorage); ok {
+			if tups, ok, err := is.lookup(cols[0], key[0]); ok || err != nil {
+				return tups, err
+			}
+		}
+	}
+	tups := []*tuple{}
+	err := t.store.scan(func(tup *tuple) error {
+		if k := valuesAt(tup.values, cols); k != nil && hashKey(k) == hashKey(key) {
+			tups = append(tups, tup)
+		}
+		return nil
+	})
+	return tups, err
+}
+
+// valuesAt returns the values at the indexes, or nil if any of them is NULL
+func valuesAt(vals []interface{}, idxs []int) []interface{} {
+	key := []interface{}{}
+	for _, idx := range idxs {
+		if vals[idx] == nil {
+			return nil
+		}
+		key = append(key, vals[idx])
+	}
+	return key
+}
+
+func formatValues(vals []interface{}) string {
+	strs := []string{}
+	for _, v := range vals {
+		strs = append(strs, fmt.Sprint(v))
+	}
+	return strings.Join(strs, ", ")
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// withTypes runs f with the catalog of types and items referencing them,
+// deleted by the action
+func withTypes(action fkAction, f func(types, items *table)) {
+	withCatalog(func() {
+		types, _ := create("types", []string{"type_id", "type_name"},
+			primaryKey("type_id"),
+		)
+		types.insert(1, "fruit")
+		types.insert(2, "vegetable")
+		items, _ := create("items", []string{"id", "type_id"},
+			primaryKey("id"),
+			references([]string{"type_id"}, "types").onDeleteDo(action),
+		)
+		items.insert(0, 1)
+		items.insert(1, 1)
+		items.insert(2, 2)
+		f(types, items)
+	})
+}
+
+func TestForeignKeyInsert(t *testing.T) {
+	withTypes(restrictAction, func(types, items *table) {
+		err := items.insert(3, 4)
+		if assert.IsType(t, &ErrConstraint{}, err) {
+			assert.Equal(t, "items_type_id_fkey", err.(*ErrConstraint).Constraint)
+		}
+		assert.NoError(t, items.insert(3, nil), "NULL should reference nothing")
+		assert.Equal(t, 4, len(from(items).tuples))
+	})
+}
+
+func TestForeignKeyUpdate(t *testing.T) {
+	withTypes(restrictAction, func(types, items *table) {
+		_, err := items.update(
+			from(items).equal("id", 0).tuples,
+			map[string]interface{}{"type_id": 4},
+		)
+		assert.IsType(t, &ErrConstraint{}, err)
+		_, err = types.update(
+			from(types).equal("type_id", 1).tuples,
+			map[string]interface{}{"type_id": 4},
+		)
+		assert.IsType(t, &ErrConstraint{}, err, "type 1 should be referenced")
+		n, err := types.update(
+			from(types).equal("type_id", 1).tuples,
+			map[string]interface{}{"type_name": "fruits"},
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+}
+
+func TestForeignKeyRestrict(t *testing.T) {
+	withTypes(restrictAction, func(types, items *table) {
+		_, err := types.delete(from(types).equal("type_id", 1).tuples)
+		assert.IsType(t, &ErrConstraint{}, err)
+		assert.Equal(t, 2, len(from(types).tuples))
+		items.delete(from(items).equal("type_id", 1).tuples)
+		_, err = types.delete(from(types).equal("type_id", 1).tuples)
+		assert.NoError(t, err)
+	})
+}
+
+func TestForeignKeyCascade(t *testing.T) {
+	withTypes(cascadeAction, func(types, items *table) {
+		n, err := types.delete(from(types).equal("type_id", 1).tuples)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []interface{}{2}, ids(from(items)))
+	})
+}
+
+func TestForeignKeySetNull(t *testing.T) {
+	withTypes(setNullAction, func(types, items *table) {
+		_, err := types.delete(from(types).equal("type_id", 1).tuples)
+		assert.NoError(t, err)
+		typeIDs := []interface{}{}
+		for _, tup := range from(items).tuples {
+			typeIDs = append(typeIDs, tup.values[1])
+		}
+		assert.Equal(t, []interface{}{nil, nil, 2}, typeIDs)
+	})
+}
+
+func TestForeignKeyCascadeRestricted(t *testing.T) {
+	withTypes(cascadeAction, func(types, items *table) {
+		orders, _ := create("orders", []string{"id", "item_id"},
+			references([]string{"item_id"}, "items"),
+		)
+		orders.insert(0, 1)
+		_, err := types.delete(from(types).equal("type_id", 1).tuples)
+		assert.IsType(t, &ErrConstraint{}, err)
+		assert.Equal(t, 2, len(from(types).tuples), "it should delete no rows")
+		assert.Equal(t, 3, len(from(items).tuples), "it should delete no rows")
+	})
+}
+
+func TestForeignKeySelf(t *testing.T) {
+	withCatalog(func() {
+		tbl, _ := create("nodes", []string{"id", "parent"},
+			primaryKey("id"),
+			references([]string{"parent"}, "nodes").onDeleteDo(cascadeAction),
+		)
+		assert.NoError(t, tbl.insert(0, nil))
+		assert.NoError(t, tbl.insert(1, 0))
+		assert.NoError(t, tbl.insert(2, 1))
+		assert.Error(t, tbl.insert(3, 4))
+		_, err := tbl.delete(from(tbl).equal("id", 0).tuples)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(from(tbl).tuples))
+	})
+}
+
+func TestInvalidForeignKeys(t *testing.T) {
+	withCatalog(func() {
+		create("types", []string{"type_id", "type_name"}, primaryKey("type_id"))
+		create("tags", []string{"tag"})
+		for _, fk := range []foreignKeyDef{
+			references([]string{"type_id"}, "none"),
+			references([]string{"type_id"}, "tags"),
+			references([]string{"type_id"}, "types", "type_name"),
+			references([]string{"type_id", "id"}, "types"),
+			references([]string{"none"}, "types"),
+		} {
+			_, err := create("items", []string{"id", "type_id"}, fk)
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestForeignKeysSaveOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withTypes(setNullAction, func(types, items *table) {
+		assert.NoError(t, save(path))
+		tables = map[string]*table{}
+		assert.NoError(t, open(path))
+		items = tables["items"]
+		if assert.Equal(t, 1, len(items.foreignKeys)) {
+			assert.Equal(t, &foreignKey{
+				name:       "items_type_id_fkey",
+				columns:    []int{1},
+				refTable:   "types",
+				refColumns: []string{"type_id"},
+				onDelete:   setNullAction,
+			}, items.foreignKeys[0])
+		}
+		assert.Error(t, items.insert(3, 4))
+	})
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// heapFile stores the tuples of a table in the slotted pages of a file,
+// which are read through the buffer pool, so that only the pages in use
+// are kept in the memory. the relations scanned from it are lazy,
+// which read the rows one page at a time as the operators need them.
+// the first page holds the schema, and the others the rows.
+// rows are appended to the last page, without reusing the space of others.
+// the mutations are not logged: while the log syncs every record,
+// the pages are written back and synced after each mutation instead,
+// so none is lost once it has succeeded, but a crash in the middle of
+// writing the pages may leave a mutation partially written
+type heapFile struct {
+	file *pageFile
+	pool *bufferPool
+}
+
+// errNoRoom is reported for an update which makes a row too large
+// for the free space of its page
+var errNoRoom = errors.New("row does not fit in its page")
+
+// written makes the mutation just made durable, if the log syncs always
+func (h *heapFile) written() error {
+	if journal == nil || journal.policy != syncAlways {
+		return nil
+	}
+	return h.pool.flush(h.file)
+}
+
+// the rowID of a row in a heap file is where it is stored.
+// it is never noRowID, since the first page holds no rows
+func heapRowID(id pageID, slot int) rowID {
+	return rowID(int64(id)<<16 | int64(slot))
+}
+
+func (rid rowID) page() pageID {
+	return pageID(rid >> 16)
+}
+
+func (rid rowID) slot() int {
+	return int(rid & 0xffff)
+}
+
+// maxRowSize is the largest row which fits in an empty page
+const maxRowSize = pageSize - pageHeaderSize - slotSize
+
+// createPagedTable registers a new table stored in the file at path.
+// paged tables are kept by their own files, instead of the snapshot
+// and the log of the catalog
+func createPagedTable(
+	name string, defs []columnDef, path string, pool *bufferPool,
+	cons ...constraintDef,
+) (*table, error) {
+	if _, ok := tables[name]; ok {
+		return nil, fmt.Errorf("table already exists: %s", name)
+	}
+	t, err := newTypedTable(name, defs, cons...)
+	if err != nil {
+		return nil, err
+	}
+	pf, err := openPageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if pf.nPages > 0 {
+		pf.close()
+		return nil, fmt.Errorf("%s: file already exists", path)
+	}
+	schema := &bytes.Buffer{}
+	writeSchema(schema, t)
+	if schema.Len() > maxRowSize {
+		pf.close()
+		return nil, fmt.Errorf("%s: too many columns", name)
+	}
+	fr, err := pool.allocate(pf)
+	if err != nil {
+		pf.close()
+		return nil, err
+	}
+	fr.data.insert(schema.Bytes())
+	pool.unpin(fr, true)
+	h := &heapFile{file: pf, pool: pool}
+	if err := h.written(); err != nil {
+		h.close()
+		return nil, err
+	}
+	t.store = h
+	tables[name] = t
+	return t, nil
+}
+
+// openPagedTable registers the table stored in the file at path
+func openPagedTable(path string, pool *bufferPool) (*table, error) {
+	pf, err := openPageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fr, err := pool.fetch(pf, 0)
+	if err != nil {
+		pf.close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	rec := fr.data.get(0)
+	var t *table
+	if rec == nil {
+		err = fmt.Errorf("no schema")
+	} else {
+		t, err = readSchema(bytes.NewReader(rec))
+	}
+	pool.unpin(fr, false)
+	if err == nil {
+		if _, ok := tables[t.name]; ok {
+			err = fmt.Errorf("table already exists: %s", t.name)
+		}
+	}
+	if err != nil {
+		pool.release(pf)
+		pf.close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	t.store = &heapFile{file: pf, pool: pool}
+	if err = t.reindex(); err != nil {
+		t.store.close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	tables[t.name] = t
+	return t, nil
+}
+
+// saveSchema rewrites the schema of t in the first page
+func (h *heapFile) saveSchema(t *table) error {
+	schema := &bytes.Buffer{}
+	writeSchema(schema, t)
+	fr, err := h.pool.fetch(h.file, 0)
+	if err != nil {
+		return err
+	}
+	ok := fr.data.update(0, schema.Bytes())
+	h.pool.unpin(fr, ok)
+	if !ok {
+		return fmt.Errorf("%s: too many columns", t.name)
+	}
+	return h.written()
+}
+
+func (h *heapFile) insert(row []interface{}) (*tuple, error) {
+	rec, err := encodeHeapRow(row)
+	if err != nil {
+		return nil, err
+	}
+	if last := pageID(h.file.nPages - 1); last > 0 {
+		fr, err := h.pool.fetch(h.file, last)
+		if err != nil {
+			return nil, err
+		}
+		slot, ok := fr.data.insert(rec)
+		h.pool.unpin(fr, ok)
+		if ok {
+			return &tuple{values: row, rid: heapRowID(last, slot)}, h.written()
+		}
+	}
+	fr, err := h.pool.allocate(h.file)
+	if err != nil {
+		return nil, err
+	}
+	slot, _ := fr.data.insert(rec)
+	h.pool.unpin(fr, true)
+	return &tuple{values: row, rid: heapRowID(fr.id(), slot)}, h.written()
+}
+
+func encodeHeapRow(row []interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writeRow(buf, row)
+	if buf.Len() > maxRowSize {
+		return nil, fmt.Errorf("row too large: %d bytes", buf.Len())
+	}
+	return buf.Bytes(), nil
+}
+
+// scan calls f for each row in order of the pages and the slots.
+// a page is unpinned before f is called for its rows
+func (h *heapFile) scan(f func(tup *tuple) error) error {
+	for id := pageID(1); int(id) < h.file.nPages; id++ {
+		fr, err := h.pool.fetch(h.file, id)
+		if err != nil {
+			return err
+		}
+		tups := []*tuple{}
+		for slot := 0; slot < fr.data.slotCount(); slot++ {
+			rec := fr.data.get(slot)
+			if rec == nil {
+				continue
+			}
+			row, err := readRow(bytes.NewReader(rec))
+			if err != nil {
+				h.pool.unpin(fr, false)
+				return fmt.Errorf("page %d slot %d: %v", id, slot, err)
+			}
+			tups = append(tups, &tuple{values: row, rid: heapRowID(id, slot)})
+		}
+		h.pool.unpin(fr, false)
+		for _, tup := range tups {
+			if err := f(tup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// page fetches the page of the row, which the caller must unpin
+func (h *heapFile) page(rid rowID) (*frame, error) {
+	if rid.page() < 1 || int(rid.page()) >= h.file.nPages {
+		return nil, errNoRow
+	}
+	return h.pool.fetch(h.file, rid.page())
+}
+
+func (h *heapFile) fetch(rid rowID) (*tuple, error) {
+	fr, err := h.page(rid)
+	if err != nil {
+		return nil, err
+	}
+	defer h.pool.unpin(fr, false)
+	rec := fr.data.get(rid.slot())
+	if rec == nil {
+		return nil, errNoRow
+	}
+	row, err := readRow(bytes.NewReader(rec))
+	if err != nil {
+		return nil, err
+	}
+	return &tuple{values: row, rid: rid}, nil
+}
+
+// update rewrites the row in its slot. the row is never moved,
+// as a move would be an insert and a delete which a crash could split,
+// so it reports errNoRoom if the row no longer fits in the page
+func (h *heapFile) update(rid rowID, row []interface{}) (*tuple, error) {
+	rec, err := encodeHeapRow(row)
+	if err != nil {
+		return nil, err
+	}
+	fr, err := h.page(rid)
+	if err != nil {
+		return nil, err
+	}
+	if fr.data.get(rid.slot()) == nil {
+		h.pool.unpin(fr, false)
+		return nil, errNoRow
+	}
+	if !fr.data.update(rid.slot(), rec) {
+		h.pool.unpin(fr, false)
+		return nil, errNoRoom
+	}
+	h.pool.unpin(fr, true)
+	return &tuple{values: row, rid: rid}, h.written()
+}
+
+func (h *heapFile) delete(rid rowID) error {
+	fr, err := h.page(rid)
+	if err != nil {
+		return err
+	}
+	if fr.data.get(rid.slot()) == nil {
+		h.pool.unpin(fr, false)
+		return errNoRow
+	}
+	fr.data.delete(rid.slot())
+	h.pool.unpin(fr, true)
+	return h.written()
+}
+
+// close writes back the pages of the file and closes it
+func (h *heapFile) close() error {
+	if err := h.pool.release(h.file); err != nil {
+		return err
+	}
+	return h.file.close()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pagedDefs = []columnDef{{"id", typeInteger}, {"name", typeText}}
+
+func TestPagedTableScan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	pool := newBufferPool(2)
+	tbl, err := createPagedTable("TestPagedTableScan", pagedDefs, path, pool)
+	assert.NoError(t, err)
+	defer drop("TestPagedTableScan")
+	name := strings.Repeat("x", 100)
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, tbl.insert(i, name))
+	}
+	assert.True(t, tbl.store.(*heapFile).file.nPages > 10)
+	assert.True(t, len(pool.frames) <= 2)
+	res := from("TestPagedTableScan").lessThan("id", 500).load()
+	assert.NoError(t, res.err)
+	assert.Equal(t, 500, len(res.tuples))
+	assert.Equal(t, []interface{}{499, name}, res.tuples[499].values)
+}
+
+func TestPagedTableReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	pool := newBufferPool(4)
+	tbl, _ := createPagedTable("TestPagedTableReopen", pagedDefs, path, pool)
+	tbl.insert(0, "zero")
+	tbl.insert(1, nil)
+	assert.True(t, drop("TestPagedTableReopen"))
+	assert.Equal(t, 0, len(pool.frames))
+
+	tbl, err := openPagedTable(path, pool)
+	assert.NoError(t, err)
+	defer drop("TestPagedTableReopen")
+	assert.Equal(t, "TestPagedTableReopen", tbl.name)
+	assert.Equal(t, typeText, tbl.columns[1].typ)
+	res := from("TestPagedTableReopen").load()
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, []interface{}{1, nil}, res.tuples[1].values)
+}
+
+func TestPagedTableSync(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.pages")
+	withWAL(t, filepath.Join(dir, "test.db"), func() {
+		tbl, _ := createPagedTable("paged", pagedDefs, path, newBufferPool(4))
+		defer drop("paged")
+		assert.NoError(t, tbl.insert(0, "zero"))
+		// the page is read from the file, as if the process crashed
+		pf, err := openPageFile(path)
+		if assert.NoError(t, err) {
+			defer pf.close()
+			p := make(page, pageSize)
+			assert.NoError(t, pf.read(1, p))
+			row, err := readRow(bytes.NewReader(p.get(0)))
+			assert.NoError(t, err)
+			assert.Equal(t, []interface{}{0, "zero"}, row)
+		}
+	})
+}
+
+func TestPagedTableExists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	pool := newBufferPool(4)
+	createPagedTable("TestPagedTableExists", pagedDefs, path, pool)
+	defer drop("TestPagedTableExists")
+	_, err := createPagedTable("TestPagedTableExists2", pagedDefs, path, pool)
+	assert.Error(t, err)
+	_, err = openPagedTable(path, pool)
+	assert.Error(t, err)
+}
+
+func TestPagedTableRowTooLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	tbl, _ := createPagedTable(
+		"TestPagedTableRowTooLarge", pagedDefs, path, newBufferPool(4),
+	)
+	defer drop("TestPagedTableRowTooLarge")
+	assert.Error(t, tbl.insert(0, strings.Repeat("x", pageSize)))
+	assert.Equal(t, 0, len(from("TestPagedTableRowTooLarge").load().tuples))
+}
+
+func TestPagedTableNotInSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	withCatalog(func() {
+		createPagedTable(
+			"paged", pagedDefs, filepath.Join(dir, "test.pages"), newBufferPool(4),
+		)
+		assert.NoError(t, save(filepath.Join(dir, "test.db")))
+		drop("paged")
+		assert.NoError(t, open(filepath.Join(dir, "test.db")))
+		assert.Equal(t, 0, len(tables))
+	})
+}
+
+func TestPagedTableUpdateDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	tbl, _ := createPagedTable(
+		"TestPagedTableUpdateDelete", pagedDefs, path, newBufferPool(4),
+	)
+	defer drop("TestPagedTableUpdateDelete")
+	tbl.insert(0, "zero")
+	tbl.insert(1, "one")
+	old := from(tbl).load()
+	n, err := tbl.update(
+		old.equal("id", 1).tuples, map[string]interface{}{"name": "ONE"},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = tbl.delete(old.equal("id", 0).tuples)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	res := from(tbl).load()
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{1, "ONE"}, res.tuples[0].values)
+}
+
+func TestPagedTableStaleDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	tbl, _ := createPagedTable(
+		"TestPagedTableStaleDelete", pagedDefs, path, newBufferPool(4),
+	)
+	defer drop("TestPagedTableStaleDelete")
+	tbl.insert(0, "zero")
+	old := from(tbl).load()
+	tbl.delete(old.tuples)
+	tbl.insert(1, "one")
+	n, err := tbl.delete(old.tuples)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n, "the stale tuple should not delete the new row")
+	assert.Equal(t, []interface{}{1}, ids(from(tbl)))
+}
+
+func TestPagedTableUpdateNoRoom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	tbl, _ := createPagedTable(
+		"TestPagedTableUpdateNoRoom", pagedDefs, path, newBufferPool(4),
+	)
+	defer drop("TestPagedTableUpdateNoRoom")
+	long := strings.Repeat("x", 1000)
+	for i := 0; i < 4; i++ {
+		tbl.insert(i, long)
+	}
+	old := from(tbl).load()
+	_, err := tbl.update(
+		old.equal("id", 0).tuples,
+		map[string]interface{}{"name": strings.Repeat("y", 2000)},
+	)
+	assert.Equal(t, errNoRoom, err)
+	assert.Equal(t, old.tuples, from(tbl).load().tuples)
+}
+
+func TestPagedTableLazyScan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	tbl, _ := createPagedTable(
+		"TestPagedTableLazyScan", pagedDefs, path, newBufferPool(2),
+	)
+	defer drop("TestPagedTableLazyScan")
+	for i := 0; i < 1000; i++ {
+		tbl.insert(i, strings.Repeat("x", 100))
+	}
+	assert.Nil(t, from(tbl).tuples, "the rows should be read as needed")
+	res, err := query("SELECT COUNT(*), MAX(id) FROM TestPagedTableLazyScan " +
+		"WHERE id >= 100")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{900, 999}, res.tuples[0].values)
+	res, err = query("SELECT id FROM TestPagedTableLazyScan LIMIT 2 OFFSET 3")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{3, 4}, ids(res))
+	res, err = query("SELECT id FROM TestPagedTableLazyScan " +
+		"ORDER BY id DESC LIMIT 2")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{999, 998}, ids(res))
+}
+
+func TestPagedTableModifiedSinceScan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	tbl, _ := createPagedTable(
+		"TestPagedTableModifiedSinceScan", pagedDefs, path, newBufferPool(4),
+	)
+	defer drop("TestPagedTableModifiedSinceScan")
+	tbl.insert(0, "zero")
+	res := from(tbl)
+	tbl.insert(1, "one")
+	assert.Error(t, res.load().err)
+	assert.Equal(t, []interface{}{0, 1}, ids(from(tbl)))
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// indexKind is the structure of an index. a B+tree finds the ranges
+// of the values, and a hash table only the values equal to a key,
+// but it does so without comparing the keys on the way
+type indexKind int
+
+const (
+	btreeIndex indexKind = iota
+	hashIndex
+)
+
+var indexKindNames = []string{"BTREE", "HASH"}
+
+func (k indexKind) String() string {
+	return indexKindNames[k]
+}
+
+func parseIndexKind(name string) (indexKind, error) {
+	for k, n := range indexKindNames {
+		if strings.EqualFold(name, n) {
+			return indexKind(k), nil
+		}
+	}
+	return btreeIndex, fmt.Errorf("unknown index type: %s", name)
+}
+
+// index maps the values of columns of a table to the rows, by which
+// they are found without scanning the table. the keys with NULLs are not
+// indexed, since no predicate which can use the index matches them.
+// the buckets of a hash index are keyed by hashKey of the values,
+// and the rowIDs in each of them are kept in order.
+// B+trees are on a single column, and hash indexes may be on several ones,
+// which back the constraints of the composite keys
+type index struct {
+	name     string
+	columns  []int
+	kind     indexKind
+	implicit bool // made for a constraint, instead of CREATE INDEX
+	tree     *btree
+	buckets  map[string][]rowID
+}
+
+func newIndex(name string, columns []int, kind indexKind) *index {
+	ix := &index{name: name, columns: columns, kind: kind}
+	ix.clear()
+	return ix
+}
+
+func (ix *index) clear() {
+	if ix.kind == hashIndex {
+		ix.buckets = map[string][]rowID{}
+	} else {
+		ix.tree = newBTree(defaultBTreeOrder)
+	}
+}
+
+// key returns the values of the indexed columns,
+// or nil if any of them is NULL
+func (ix *index) key(vals []interface{}) []interface{} {
+	key := []interface{}{}
+	for _, idx := range ix.columns {
+		if vals[idx] == nil {
+			return nil
+		}
+		key = append(key, vals[idx])
+	}
+	return key
+}
+
+func (ix *index) add(tup *tuple) {
+	key := ix.key(tup.values)
+	if key == nil {
+		return
+	}
+	if ix.kind == btreeIndex {
+		ix.tree.insert(indexKey{key[0], tup.rid})
+		return
+	}
+	k := hashKey(key)
+	rids := ix.buckets[k]
+	i := sort.Search(len(rids), func(i int) bool { return rids[i] >= tup.rid })
+	rids = append(rids, noRowID)
+	copy(rids[i+1:], rids[i:])
+	rids[i] = tup.rid
+	ix.buckets[k] = rids
+}
+
+func (ix *index) remove(tup *tuple) {
+	key := ix.key(tup.values)
+	if key == nil {
+		return
+	}
+	if ix.kind == btreeIndex {
+		ix.tree.delete(indexKey{key[0], tup.rid})
+		return
+	}
+	k := hashKey(key)
+	rids := ix.buckets[k]
+	i := sort.Search(len(rids), func(i int) bool { return rids[i] >= tup.rid })
+	if i == len(rids) || rids[i] != tup.rid {
+		return
+	}
+	if len(rids) == 1 {
+		delete(ix.buckets, k)
+		return
+	}
+	ix.buckets[k] = append(rids[:i], rids[i+1:]...)
+}
+
+// canFind reports whether the index can find the values in a range,
+// or only in a point range for a key
+func (ix *index) canFind(point bool) bool {
+	return ix.kind == btreeIndex || point
+}
+
+// find returns the rowIDs of the values in the range,
+// in order of the values and then of the rowIDs
+func (ix *index) find(kr keyRange) []rowID {
+	if ix.kind == hashIndex {
+		return ix.lookup([]interface{}{kr.low})
+	}
+	rids := []rowID{}
+	ix.tree.scan(kr.started, func(k indexKey) bool {
+		if !kr.before(k) {
+			return false
+		}
+		rids = append(rids, k.rid)
+		return true
+	})
+	return rids
+}
+
+// lookup returns the rowIDs of the key in a hash index
+func (ix *index) lookup(key []interface{}) []rowID {
+	return append([]rowID{}, ix.buckets[hashKey(key)]...)
+}
+
+// keyRange is the range of the values for which an index is scanned,
+// where a nil bound is open. the values of the other types than
+// the bounds are out of the range, as they are not comparable
+type keyRange struct {
+	low, high       interface{}
+	lowInc, highInc bool
+}
+
+func pointRange(v interface{}) keyRange {
+	return keyRange{low: v, high: v, lowInc: true, highInc: true}
+}
+
+func (kr keyRange) isPoint() bool {
+	if kr.low == nil || !kr.lowInc || !kr.highInc {
+		return false
+	}
+	c, ok := compareValues(kr.low, kr.high)
+	return ok && c == 0
+}
+
+// started reports whether k is at or after the start of the range
+func (kr keyRange) started(k indexKey) bool {
+	if kr.low == nil {
+		return kr.high == nil || typeRank(k.value) >= typeRank(kr.high)
+	}
+	c := compareForSort(k.value, kr.low, false)
+	return c > 0 || c == 0 && kr.lowInc
+}
+
+// before reports whether k is before the end of the range
+func (kr keyRange) before(k indexKey) bool {
+	if kr.high == nil {
+		return kr.low == nil || typeRank(k.value) <= typeRank(kr.low)
+	}
+	c := compareForSort(k.value, kr.high, false)
+	return c < 0 || c == 0 && kr.highInc
+}
+
+// createIndex builds a new index on the column of t. the indexes are
+// saved with the tables kept in memory, but not in the files of the others,
+// which have to be indexed again after they are opened.
+// the tables whose rows may change outside of them cannot be indexed
+func (t *table) createIndex(
+	name, colName string, kind indexKind,
+) (*index, error) {
+	switch t.store.(type) {
+	case *memStore, *heapFile:
+	default:
+		return nil, fmt.Errorf("%s: not indexable", t.name)
+	}
+	if findIndex(name) != nil {
+		return nil, fmt.Errorf("index already exists: %s", name)
+	}
+	idx, err := t.lookupColumn(colName)
+	if err != nil {
+		return nil, err
+	}
+	rec := createIndexRecord(t.name, name, colName, kind)
+	if err := journal.logTable(t, rec); err != nil {
+		return nil, err
+	}
+	return t.buildIndex(name, idx, kind)
+}
+
+// buildIndex adds an index on the column at idx, filled with the rows of t
+func (t *table) buildIndex(name string, idx int, kind indexKind) (*index, error) {
+	ix := newIndex(name, []int{idx}, kind)
+	if err := fillIndexes(t, ix); err != nil {
+		return nil, err
+	}
+	t.indexes = append(t.indexes, ix)
+	return ix, nil
+}
+
+// reindex fills all the indexes of t again with the rows,
+// after they are loaded into the storage directly
+func (t *table) reindex() error {
+	for _, ix := range t.indexes {
+		ix.clear()
+	}
+	return fillIndexes(t, t.indexes...)
+}
+
+func fillIndexes(t *table, ixs ...*index) error {
+	return t.store.scan(func(tup *tuple) error {
+		for _, ix := range ixs {
+			ix.add(tup)
+		}
+		return nil
+	})
+}
+
+// indexOn returns an index on the column at idx which can find
+// the values in a range, or in a point range if point, or nil if none.
+// hash indexes are preferred for the point ranges
+func (t *table) indexOn(idx int, point bool) *index {
+	var found *index
+	for _, ix := range t.indexes {
+		if len(ix.columns) != 1 || ix.columns[0] != idx || !ix.canFind(point) {
+			continue
+		}
+		if found == nil || ix.kind == hashIndex {
+			found = ix
+		}
+	}
+	return found
+}
+
+// fetchAll fetches the rows of the rowIDs from the storage of t
+func (t *table) fetchAll(rids []rowID) ([]*tuple, error) {
+	tups := []*tuple{}
+	for _, rid := range rids {
+		tup, err := t.store.fetch(rid)
+		if err != nil {
+			return nil, err
+		}
+		tups = append(tups, tup)
+	}
+	return tups, nil
+}
+
+// findIndex returns the table which has the index of the name, or nil
+func findIndex(name string) *table {
+	for _, t := range tables {
+		for _, ix := range t.indexes {
+			if ix.name == name {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// indexFor returns the index on the column at idx which can be used
+// instead of the tuples of r, i.e. r is the scan of an indexed table
+// which has not been modified since. point is as of indexOn
+func (r *relation) indexFor(idx int, point bool) *index {
+	t := r.source
+	if t == nil || t.version != r.version {
+		return nil
+	}
+	return t.indexOn(idx, point)
+}
+
+// lookup finds the tuples of r whose value of the column at idx is the key
+// by the storage of the source, if r is its scan and it can look them up
+func (r *relation) lookup(idx int, key interface{}) ([]*tuple, bool, error) {
+	t := r.source
+	if t == nil || t.version != r.version {
+		return nil, false, nil
+	}
+	is, ok := t.store.(indexedStorage)
+	if !ok {
+		return nil, false, nil
+	}
+	return is.lookup(idx, key)
+}
+
+// indexed makes a relation of the tuples of r in the range of the index,
+// which are ordered on the indexed column
+func (r *relation) indexed(ix *index, kr keyRange) *relation {
+	tups, err := r.source.fetchAll(ix.find(kr))
+	if err != nil {
+		return r.fail(err)
+	}
+	res := newRelation(r.columns, tups)
+	res.sortedBy = []*column{r.columns[ix.columns[0]]}
+	return res
+}
+
+// indexedRange finds the conjunct of the predicate which restricts
+// an indexed column of r to a range, e.g. price < 250,
+// so that where has only to test the tuples in the range
+func (r *relation) indexedRange(e expr) (*index, keyRange, bool) {
+	switch x := e.(type) {
+	case *andExpr:
+		for _, operand := range x.operands {
+			if ix, kr, ok := r.indexedRange(operand); ok {
+				return ix, kr, true
+			}
+		}
+	case *comparison:
+		op, col, l := x.op, x.left, x.right
+		if _, ok := col.(*colRef); !ok {
+			// 250 > price is the same as price < 250
+			op, col, l = flippedOps[op], x.right, x.left
+		}
+		v, ok := l.(*literal)
+		if !ok || v.value == nil {
+			break
+		}
+		var kr keyRange
+		switch op {
+		case "=":
+			kr = pointRange(v.value)
+		case "<", "<=":
+			kr = keyRange{high: v.value, highInc: op == "<="}
+		case ">", ">=":
+			kr = keyRange{low: v.value, lowInc: op == ">="}
+		default:
+			return nil, keyRange{}, false
+		}
+		return r.indexedColumn(col, kr)
+	case *betweenExpr:
+		low, ok1 := x.low.(*literal)
+		high, ok2 := x.high.(*literal)
+		if x.negated || !ok1 || !ok2 || low.value == nil || high.value == nil {
+			break
+		}
+		return r.indexedColumn(x.operand, keyRange{
+			low: low.value, high: high.value, lowInc: true, highInc: true,
+		})
+	}
+	return nil, keyRange{}, false
+}
+
+var flippedOps = map[string]string{
+	"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<=",
+}
+
+// indexedColumn returns the index which finds the range
+// if col is a column of r indexed for it
+func (r *relation) indexedColumn(col expr, kr keyRange) (*index, keyRange, bool) {
+	c, ok := col.(*colRef)
+	if !ok {
+		return nil, keyRange{}, false
+	}
+	idx := r.findColumn(c.name)
+	if idx == len(r.columns) {
+		return nil, keyRange{}, false
+	}
+	ix := r.indexFor(idx, kr.isPoint())
+	return ix, kr, ix != nil
+}
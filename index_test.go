@@ -0,0 +1,241 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// indexedTable makes a table of the prices indexed on price,
+// which is unregistered by the returned function
+func indexedTable(t *testing.T, name string) (*table, func()) {
+	tbl, _ := create(name, []string{"id", "price"})
+	tbl.insert(0, 300)
+	tbl.insert(1, 130)
+	tbl.insert(2, nil)
+	tbl.insert(3, 200)
+	tbl.insert(4, 130.0)
+	_, err := tbl.createIndex(name+"_price", "price", btreeIndex)
+	assert.NoError(t, err)
+	return tbl, func() { drop(name) }
+}
+
+func TestIndexEqual(t *testing.T) {
+	_, cleanup := indexedTable(t, "TestIndexEqual")
+	defer cleanup()
+	res := from("TestIndexEqual").equal("price", 130)
+	assert.NoError(t, res.err)
+	assert.Equal(t, []interface{}{1, 4}, ids(res))
+	assert.Equal(t, 1, len(res.sortedBy), "it should be found by the index")
+}
+
+func TestIndexLessThan(t *testing.T) {
+	_, cleanup := indexedTable(t, "TestIndexLessThan")
+	defer cleanup()
+	res := from("TestIndexLessThan").lessThan("price", 300)
+	assert.Equal(t, []interface{}{1, 4, 3}, ids(res))
+	assert.Equal(t, "price", res.sortedBy[0].name)
+}
+
+func TestIndexOtherTypes(t *testing.T) {
+	tbl, cleanup := indexedTable(t, "TestIndexOtherTypes")
+	defer cleanup()
+	tbl.insert(5, "cheap")
+	tbl.insert(6, true)
+	res := from("TestIndexOtherTypes").lessThan("price", 200)
+	assert.Equal(t, []interface{}{1, 4}, ids(res))
+	res = from("TestIndexOtherTypes").where(gt(ref("price"), lit(200)))
+	assert.Equal(t, []interface{}{0}, ids(res))
+}
+
+func TestIndexWhereRange(t *testing.T) {
+	_, cleanup := indexedTable(t, "TestIndexWhereRange")
+	defer cleanup()
+	r := from("TestIndexWhereRange")
+	res := r.where(and(ge(ref("price"), lit(130)), lt(ref("id"), lit(3))))
+	assert.Equal(t, []interface{}{1, 0}, ids(res))
+	res = r.where(le(lit(200), ref("price")))
+	assert.Equal(t, []interface{}{3, 0}, ids(res))
+	res = r.where(between(ref("price"), lit(100), lit(200)))
+	assert.Equal(t, []interface{}{1, 4, 3}, ids(res))
+	res = r.where(eq(ref("price"), lit(nil)))
+	assert.Equal(t, 0, len(res.tuples))
+}
+
+func TestIndexMaintained(t *testing.T) {
+	tbl, cleanup := indexedTable(t, "TestIndexMaintained")
+	defer cleanup()
+	r := from(tbl)
+	tbl.update(r.equal("id", 0).tuples, map[string]interface{}{"price": 100})
+	tbl.delete(r.equal("id", 1).tuples)
+	tbl.insert(5, 150)
+	res := from(tbl).lessThan("price", 200)
+	assert.Equal(t, []interface{}{0, 4, 5}, ids(res))
+	assert.Equal(t, 0, len(from(tbl).equal("price", 300).tuples))
+}
+
+func TestIndexStaleRelation(t *testing.T) {
+	tbl, cleanup := indexedTable(t, "TestIndexStaleRelation")
+	defer cleanup()
+	old := from(tbl)
+	tbl.insert(5, 130)
+	res := old.equal("price", 130)
+	assert.Equal(t, []interface{}{1, 4}, ids(res),
+		"it should not see the rows inserted after the scan")
+}
+
+func TestIndexJoin(t *testing.T) {
+	_, cleanup := indexedTable(t, "TestIndexJoin")
+	defer cleanup()
+	prices := newRelation(
+		[]*column{newColumn("", "price")},
+		[]*tuple{newTuple([]interface{}{130}), newTuple([]interface{}{nil}),
+			newTuple([]interface{}{500}), newTuple([]interface{}{200})},
+	)
+	indexed := prices.leftJoin("TestIndexJoin", "price")
+	hashed := prices.joinWith(
+		hashJoinStrategy, leftJoinKind, "TestIndexJoin", on("price", "price"),
+	)
+	assert.NoError(t, indexed.err)
+	assert.Equal(t, 5, len(indexed.tuples))
+	for i := range hashed.tuples {
+		assert.Equal(t, hashed.tuples[i].values, indexed.tuples[i].values)
+	}
+}
+
+func TestIndexJoinWithoutIndex(t *testing.T) {
+	_, cleanup := indexedTable(t, "TestIndexJoinWithoutIndex")
+	defer cleanup()
+	res := from("TestIndexJoinWithoutIndex").joinWith(
+		indexJoinStrategy, innerJoinKind, "TestIndexJoinWithoutIndex",
+		on("id", "id"),
+	)
+	assert.Error(t, res.err)
+}
+
+func TestCreateIndexErrors(t *testing.T) {
+	tbl, cleanup := indexedTable(t, "TestCreateIndexErrors")
+	defer cleanup()
+	_, err := tbl.createIndex("TestCreateIndexErrors_price", "id", btreeIndex)
+	assert.Error(t, err)
+	_, err = tbl.createIndex(
+		"TestCreateIndexErrors_unknown", "unknown", btreeIndex,
+	)
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(tbl.indexes))
+}
+
+func TestIndexSaveOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withCatalog(func() {
+		indexedTable(t, "prices")
+		assert.NoError(t, save(path))
+		tables = map[string]*table{}
+		assert.NoError(t, open(path))
+		res := from("prices").equal("price", 130)
+		assert.Equal(t, []interface{}{1, 4}, ids(res))
+		assert.Equal(t, 1, len(res.sortedBy))
+	})
+}
+
+func TestIndexWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		indexedTable(t, "prices")
+		tables["prices"].delete(from("prices").equal("id", 1).tuples)
+	})
+	withWAL(t, path, func() {
+		res := from("prices").equal("price", 130)
+		assert.Equal(t, []interface{}{4}, ids(res))
+		assert.Equal(t, 1, len(res.sortedBy))
+	})
+}
+
+// hashedTable makes a table of the items indexed on id by a hash index
+func hashedTable(t *testing.T, name string) (*table, func()) {
+	tbl, _ := create(name, []string{"id", "name"})
+	tbl.insert(2, "cabbage")
+	tbl.insert(1, "apple")
+	tbl.insert(nil, "unknown")
+	tbl.insert(1.0, "orange")
+	ix, err := tbl.createIndex(name+"_id", "id", hashIndex)
+	assert.NoError(t, err)
+	assert.Equal(t, hashIndex, ix.kind)
+	return tbl, func() { drop(name) }
+}
+
+func names(r *relation) []interface{} {
+	vals := []interface{}{}
+	for _, tup := range r.tuples {
+		vals = append(vals, tup.values[1])
+	}
+	return vals
+}
+
+func TestHashIndexEqual(t *testing.T) {
+	_, cleanup := hashedTable(t, "TestHashIndexEqual")
+	defer cleanup()
+	res := from("TestHashIndexEqual").equal("id", 1)
+	assert.Equal(t, []interface{}{"apple", "orange"}, names(res))
+	assert.Equal(t, 1, len(res.sortedBy), "it should be found by the index")
+	res = from("TestHashIndexEqual").where(eq(lit(2), ref("id")))
+	assert.Equal(t, []interface{}{"cabbage"}, names(res))
+	assert.Equal(t, 1, len(res.sortedBy))
+}
+
+func TestHashIndexNotForRange(t *testing.T) {
+	_, cleanup := hashedTable(t, "TestHashIndexNotForRange")
+	defer cleanup()
+	res := from("TestHashIndexNotForRange").lessThan("id", 2)
+	assert.Equal(t, []interface{}{"apple", "orange"}, names(res))
+	assert.Equal(t, 0, len(res.sortedBy), "it should scan the tuples")
+}
+
+func TestHashIndexPreferred(t *testing.T) {
+	tbl, cleanup := hashedTable(t, "TestHashIndexPreferred")
+	defer cleanup()
+	tbl.createIndex("TestHashIndexPreferred_btree", "id", btreeIndex)
+	assert.Equal(t, hashIndex, tbl.indexOn(0, true).kind)
+	assert.Equal(t, btreeIndex, tbl.indexOn(0, false).kind)
+}
+
+func TestHashIndexMaintained(t *testing.T) {
+	tbl, cleanup := hashedTable(t, "TestHashIndexMaintained")
+	defer cleanup()
+	r := from(tbl)
+	tbl.update(r.equal("name", "apple").tuples, map[string]interface{}{"id": 2})
+	tbl.delete(r.equal("name", "cabbage").tuples)
+	tbl.insert(1, "banana")
+	assert.Equal(t,
+		[]interface{}{"orange", "banana"}, names(from(tbl).equal("id", 1)),
+	)
+	assert.Equal(t, []interface{}{"apple"}, names(from(tbl).equal("id", 2)))
+}
+
+func TestHashIndexJoin(t *testing.T) {
+	_, cleanup := hashedTable(t, "TestHashIndexJoin")
+	defer cleanup()
+	ids := newRelation(
+		[]*column{newColumn("", "id")},
+		[]*tuple{newTuple([]interface{}{1}), newTuple([]interface{}{3})},
+	)
+	res := ids.leftJoin("TestHashIndexJoin", "id")
+	assert.NoError(t, res.err)
+	assert.Equal(t, 3, len(res.tuples))
+	assert.Equal(t, []interface{}{1, 1, "apple"}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, 1.0, "orange"}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{3, nil, nil}, res.tuples[2].values)
+}
+
+func TestHashIndexSaveOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withCatalog(func() {
+		hashedTable(t, "items")
+		assert.NoError(t, save(path))
+		tables = map[string]*table{}
+		assert.NoError(t, open(path))
+		assert.Equal(t, hashIndex, tables["items"].indexes[0].kind)
+		res := from("items").equal("id", 1)
+		assert.Equal(t, []interface{}{"apple", "orange"}, names(res))
+	})
+}
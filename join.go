@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type joinKind int
+
+const (
+	innerJoinKind joinKind = iota
+	leftJoinKind
+	rightJoinKind
+	fullJoinKind
+	crossJoinKind
+)
+
+func (r *relation) innerJoin(x interface{}, colName string) *relation {
+	return r.join(innerJoinKind, x, colName)
+}
+
+func (r *relation) leftJoin(x interface{}, colName string) *relation {
+	return r.join(leftJoinKind, x, colName)
+}
+
+func (r *relation) rightJoin(x interface{}, colName string) *relation {
+	return r.join(rightJoinKind, x, colName)
+}
+
+func (r *relation) fullOuterJoin(x interface{}, colName string) *relation {
+	return r.join(fullJoinKind, x, colName)
+}
+
+func (r *relation) crossJoin(x interface{}) *relation {
+	return r.joinOn(crossJoinKind, x)
+}
+
+// joinKey pairs a column of the left relation with a column of the right,
+// whose values should be equal in the joined tuples
+type joinKey struct {
+	left  string
+	right string
+}
+
+func on(left, right string) joinKey {
+	return joinKey{left: left, right: right}
+}
+
+// join combines the tuples of r and x by the column of the same name
+func (r *relation) join(kind joinKind, x interface{}, colName string) *relation {
+	return r.joinOn(kind, x, on(colName, colName))
+}
+
+// joinStrategy is the algorithm to match the tuples of joins.
+// autoJoinStrategy lets the planner choose one of the others
+type joinStrategy int
+
+const (
+	autoJoinStrategy joinStrategy = iota
+	hashJoinStrategy
+	mergeJoinStrategy
+	indexJoinStrategy
+)
+
+// joinOn combines the tuples of r and x whose values of all the keys
+// are equal, where no keys make every pair of the tuples combined.
+// the columns of r always come first, whatever the kind of join is.
+// the outer joins pad the unmatched tuples with NULLs,
+// and the unmatched tuples of x follow the others
+func (r *relation) joinOn(kind joinKind, x interface{}, keys ...joinKey) *relation {
+	return r.joinWith(autoJoinStrategy, kind, x, keys...)
+}
+
+// joinWith is joinOn by the given strategy. the automatic one takes
+// the index join if x is the scan of a table indexed on the key,
+// and the merge join if both relations are already ordered on the keys,
+// where they make the same result as the hash join without hashing
+func (r *relation) joinWith(
+	strategy joinStrategy, kind joinKind, x interface{}, keys ...joinKey,
+) *relation {
+	if r.err != nil {
+		return r
+	}
+	j := from(x)
+	newCols := []*column{}
+	newCols = append(newCols, r.columns...)
+	newCols = append(newCols, j.columns...)
+	if j.err != nil {
+		return newRelation(newCols, []*tuple{}).fail(j.err)
+	}
+	if r = r.load(); r.err != nil {
+		return newRelation(newCols, []*tuple{}).fail(r.err)
+	}
+	rIdxs, jIdxs := []int{}, []int{}
+	for _, k := range keys {
+		rIdx, err := r.lookupColumn(k.left)
+		if err != nil {
+			return newRelation(newCols, []*tuple{}).fail(err)
+		}
+		jIdx, err := j.lookupColumn(k.right)
+		if err != nil {
+			return newRelation(newCols, []*tuple{}).fail(err)
+		}
+		rIdxs = append(rIdxs, rIdx)
+		jIdxs = append(jIdxs, jIdx)
+	}
+	if strategy == autoJoinStrategy {
+		strategy = hashJoinStrategy
+		if r.sortedOn(rIdxs) && j.sortedOn(jIdxs) {
+			strategy = mergeJoinStrategy
+		}
+		if canIndexJoin(kind, j, jIdxs) {
+			strategy = indexJoinStrategy
+		}
+	}
+	if strategy != indexJoinStrategy {
+		// the index join looks up x instead of reading it
+		if j = j.load(); j.err != nil {
+			return newRelation(newCols, []*tuple{}).fail(j.err)
+		}
+	}
+	var newTups []*tuple
+	switch strategy {
+	case hashJoinStrategy:
+		newTups = hashJoin(kind, r, j, rIdxs, jIdxs)
+	case mergeJoinStrategy:
+		newTups = mergeJoin(kind, r, j, rIdxs, jIdxs)
+	case indexJoinStrategy:
+		if !canIndexJoin(kind, j, jIdxs) {
+			return newRelation(newCols, []*tuple{}).fail(
+				fmt.Errorf("cannot join by the index"),
+			)
+		}
+		var err error
+		if newTups, err = indexJoin(kind, r, j, rIdxs[0], jIdxs[0]); err != nil {
+			return newRelation(newCols, []*tuple{}).fail(err)
+		}
+	default:
+		return newRelation(newCols, []*tuple{}).fail(
+			fmt.Errorf("unknown join strategy: %d", strategy),
+		)
+	}
+	return newRelation(newCols, newTups)
+}
+
+func hashJoin(kind joinKind, r, x *relation, rIdxs, xIdxs []int) []*tuple {
+	// the tuples of x are hashed once and probed for each tuple of r.
+	// the buckets keep the order of x, so the result is in the same order
+	// as the nested loop over r and x would make
+	buckets := map[string][]*tuple{}
+	for _, xTup := range x.tuples {
+		if k, ok := joinHashKey(xTup, xIdxs); ok {
+			buckets[k] = append(buckets[k], xTup)
+		}
+	}
+	newTups := []*tuple{}
+	matched := map[*tuple]bool{}
+	for _, rTup := range r.tuples {
+		found := false
+		var bucket []*tuple
+		if k, ok := joinHashKey(rTup, rIdxs); ok {
+			bucket = buckets[k]
+		}
+		for _, xTup := range bucket {
+			if !keysEqual(rTup, xTup, rIdxs, xIdxs) {
+				continue
+			}
+			found = true
+			matched[xTup] = true
+			newTups = append(newTups, concatTuples(rTup, xTup, r, x))
+		}
+		if !found && (kind == leftJoinKind || kind == fullJoinKind) {
+			newTups = append(newTups, concatTuples(rTup, nil, r, x))
+		}
+	}
+	return appendUnmatched(newTups, kind, r, x, x.tuples, matched)
+}
+
+// canIndexJoin reports whether the tuples of x can be looked up
+// by an index on the key, instead of hashing all of them.
+// the unmatched tuples of x are not found by the index,
+// so right and full joins cannot use it
+func canIndexJoin(kind joinKind, x *relation, xIdxs []int) bool {
+	return (kind == innerJoinKind || kind == leftJoinKind) &&
+		len(xIdxs) == 1 && x.indexFor(xIdxs[0], true) != nil
+}
+
+// indexJoin looks up the index of x for each tuple of r. the matches
+// are in order of the rowIDs, so the result is in the same order
+// as the hash join makes
+func indexJoin(kind joinKind, r, x *relation, rIdx, xIdx int) ([]*tuple, error) {
+	ix := x.indexFor(xIdx, true)
+	newTups := []*tuple{}
+	for _, rTup := range r.tuples {
+		matches := []*tuple{}
+		if v := rTup.values[rIdx]; v != nil {
+			var err error
+			if matches, err = x.source.fetchAll(ix.find(pointRange(v))); err != nil {
+				return nil, err
+			}
+		}
+		for _, xTup := range matches {
+			newTups = append(newTups, concatTuples(rTup, xTup, r, x))
+		}
+		if len(matches) == 0 && kind == leftJoinKind {
+			newTups = append(newTups, concatTuples(rTup, nil, r, x))
+		}
+	}
+	return newTups, nil
+}
+
+// mergeJoin sorts the relations on the keys unless they are already sorted,
+// and scans them once side by side. the tuples with NULL keys stay
+// where they are in r, and are skipped in x as they never match
+func mergeJoin(kind joinKind, r, x *relation, rIdxs, xIdxs []int) []*tuple {
+	rTups := sortedTuples(r, rIdxs)
+	xTups := sortedTuples(x, xIdxs)
+	xKeyed := []*tuple{}
+	for _, xTup := range xTups {
+		if !hasNullKey(xTup, xIdxs) {
+			xKeyed = append(xKeyed, xTup)
+		}
+	}
+	newTups := []*tuple{}
+	matched := map[*tuple]bool{}
+	pos := 0
+	for _, rTup := range rTups {
+		found := false
+		if !hasNullKey(rTup, rIdxs) {
+			for pos < len(xKeyed) &&
+				compareKeys(xKeyed[pos], rTup, xIdxs, rIdxs) < 0 {
+				pos++
+			}
+			// the tuples of r with the same key scan the same run of x again
+			for i := pos; i < len(xKeyed); i++ {
+				if compareKeys(xKeyed[i], rTup, xIdxs, rIdxs) != 0 {
+					break
+				}
+				found = true
+				matched[xKeyed[i]] = true
+				newTups = append(newTups, concatTuples(rTup, xKeyed[i], r, x))
+			}
+		}
+		if !found && (kind == leftJoinKind || kind == fullJoinKind) {
+			newTups = append(newTups, concatTuples(rTup, nil, r, x))
+		}
+	}
+	return appendUnmatched(newTups, kind, r, x, xTups, matched)
+}
+
+// appendUnmatched pads the unmatched tuples of x for right and full joins
+func appendUnmatched(
+	newTups []*tuple, kind joinKind, r, x *relation,
+	xTups []*tuple, matched map[*tuple]bool,
+) []*tuple {
+	if kind != rightJoinKind && kind != fullJoinKind {
+		return newTups
+	}
+	for _, xTup := range xTups {
+		if !matched[xTup] {
+			newTups = append(newTups, concatTuples(nil, xTup, r, x))
+		}
+	}
+	return newTups
+}
+
+// sortedTuples returns the tuples of r in order of the key columns,
+// sorting a copy of them only if r is not known to be in that order.
+// the sort is stable so that the ties are in the same order as in r
+func sortedTuples(r *relation, idxs []int) []*tuple {
+	if r.sortedOn(idxs) {
+		return r.tuples
+	}
+	newTups := []*tuple{}
+	newTups = append(newTups, r.tuples...)
+	ts := &tupleSorter{
+		tuples: newTups,
+		compare: func(t1, t2 *tuple) bool {
+			return compareKeys(t1, t2, idxs, idxs) < 0
+		},
+	}
+	sort.Stable(ts)
+	return ts.tuples
+}
+
+// compareKeys compares the key values of the tuples in lexicographic order,
+// in the same order as orderBy sorts them
+func compareKeys(t1, t2 *tuple, idxs1, idxs2 []int) int {
+	for i := range idxs1 {
+		c := compareForSort(t1.values[idxs1[i]], t2.values[idxs2[i]], false)
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func hasNullKey(tup *tuple, idxs []int) bool {
+	for _, idx := range idxs {
+		if tup.values[idx] == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// keysEqual reports whether the key values of the tuples are all equal.
+// NULL keys never match, as NULL = NULL is not true
+func keysEqual(rTup, xTup *tuple, rIdxs, xIdxs []int) bool {
+	for i := range rIdxs {
+		a, b := rTup.values[rIdxs[i]], xTup.values[xIdxs[i]]
+		if a == nil || b == nil {
+			return false
+		}
+		if c, ok := compareValues(a, b); !ok || c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// joinHashKey encodes the key values of the tuple by hashKey,
+// and reports false if any of them is NULL, which never matches
+func joinHashKey(tup *tuple, idxs []int) (string, bool) {
+	vals := []interface{}{}
+	for _, idx := range idxs {
+		if tup.values[idx] == nil {
+			return "", false
+		}
+		vals = append(vals, tup.values[idx])
+	}
+	return hashKey(vals), true
+}
+
+// concatTuples makes a tuple of r joined with x,
+// where a nil tuple stands for the one filled with NULLs
+func concatTuples(rTup, xTup *tuple, r, x *relation) *tuple {
+	vals := []interface{}{}
+	if rTup != nil {
+		vals = append(vals, rTup.values...)
+	} else {
+		vals = append(vals, make([]interface{}, len(r.columns))...)
+	}
+	if xTup != nil {
+		vals = append(vals, xTup.values...)
+	} else {
+		vals = append(vals, make([]interface{}, len(x.columns))...)
+	}
+	return newTuple(vals)
+}
+
+// sortedOn reports whether the tuples are known to be ordered
+// on the columns at the indexes, the first of them most significant
+func (r *relation) sortedOn(idxs []int) bool {
+	if len(idxs) > len(r.sortedBy) {
+		return false
+	}
+	for i, idx := range idxs {
+		if r.sortedBy[i] != r.columns[idx] {
+			return false
+		}
+	}
+	return true
+}
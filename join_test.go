@@ -0,0 +1,268 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func joinRelations() (*relation, *relation) {
+	items := &relation{
+		columns: []*column{newColumn("items", "id"), newColumn("items", "type")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{0, 1}},
+			&tuple{values: []interface{}{1, 2}},
+			&tuple{values: []interface{}{2, nil}},
+			&tuple{values: []interface{}{3, 1}},
+		},
+	}
+	types := &relation{
+		columns: []*column{newColumn("types", "type"), newColumn("types", "name")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1, "fruit"}},
+			&tuple{values: []interface{}{3, "fish"}},
+			&tuple{values: []interface{}{nil, "unknown"}},
+		},
+	}
+	return items, types
+}
+
+func TestInnerJoin(t *testing.T) {
+	items, types := joinRelations()
+	res := items.innerJoin(types, "type")
+	assert.Equal(t, 4, len(res.columns))
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, []interface{}{0, 1, 1, "fruit"}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{3, 1, 1, "fruit"}, res.tuples[1].values)
+}
+
+func TestLeftJoinKeepsLeft(t *testing.T) {
+	items, types := joinRelations()
+	res := items.leftJoin(types, "type")
+	assert.Equal(t, 4, len(res.tuples))
+	assert.Equal(t, []interface{}{1, 2, nil, nil}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{2, nil, nil, nil}, res.tuples[2].values)
+}
+
+func TestRightJoin(t *testing.T) {
+	items, types := joinRelations()
+	res := items.rightJoin(types, "type")
+	assert.Equal(t, []*column{
+		newColumn("items", "id"), newColumn("items", "type"),
+		newColumn("types", "type"), newColumn("types", "name"),
+	}, res.columns, "it should not reorder the columns")
+	assert.Equal(t, 4, len(res.tuples))
+	assert.Equal(t, []interface{}{0, 1, 1, "fruit"}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{3, 1, 1, "fruit"}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{nil, nil, 3, "fish"}, res.tuples[2].values)
+	assert.Equal(t,
+		[]interface{}{nil, nil, nil, "unknown"}, res.tuples[3].values,
+	)
+}
+
+func TestFullOuterJoin(t *testing.T) {
+	items, types := joinRelations()
+	res := items.fullOuterJoin(types, "type")
+	assert.Equal(t, 6, len(res.tuples))
+	assert.Equal(t, []interface{}{0, 1, 1, "fruit"}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, 2, nil, nil}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{2, nil, nil, nil}, res.tuples[2].values)
+	assert.Equal(t, []interface{}{3, 1, 1, "fruit"}, res.tuples[3].values)
+	assert.Equal(t, []interface{}{nil, nil, 3, "fish"}, res.tuples[4].values)
+	assert.Equal(t,
+		[]interface{}{nil, nil, nil, "unknown"}, res.tuples[5].values,
+	)
+}
+
+func TestCrossJoin(t *testing.T) {
+	items, types := joinRelations()
+	res := items.crossJoin(types)
+	assert.Equal(t, 4, len(res.columns))
+	assert.Equal(t, 12, len(res.tuples))
+	assert.Equal(t, []interface{}{0, 1, 1, "fruit"}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{0, 1, 3, "fish"}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{3, 1, nil, "unknown"}, res.tuples[11].values)
+}
+
+func TestCrossJoinEmpty(t *testing.T) {
+	items, types := joinRelations()
+	types.tuples = []*tuple{}
+	res := items.crossJoin(types)
+	assert.Equal(t, 0, len(res.tuples))
+}
+
+func TestJoinByTableName(t *testing.T) {
+	items, _ := joinRelations()
+	tbl, _ := create("TestJoinByTableName", []string{"type", "name"})
+	tbl.insert(3, "fish")
+	res := items.rightJoin("TestJoinByTableName", "type")
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{nil, nil, 3, "fish"}, res.tuples[0].values)
+}
+
+func TestJoinUnknown(t *testing.T) {
+	items, types := joinRelations()
+	assert.IsType(t, &ErrUnknownColumn{}, items.innerJoin(types, "id").err)
+	assert.IsType(t, &ErrUnknownTable{}, items.crossJoin("TestJoinUnknown").err)
+}
+
+func TestJoinOnDifferentNames(t *testing.T) {
+	items, types := joinRelations()
+	types.columns[0] = newColumn("types", "id")
+	res := items.joinOn(leftJoinKind, types, on("type", "id"))
+	assert.Equal(t, 4, len(res.tuples))
+	assert.Equal(t, []interface{}{0, 1, 1, "fruit"}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, 2, nil, nil}, res.tuples[1].values)
+}
+
+func TestJoinOnQualified(t *testing.T) {
+	items, types := joinRelations()
+	res := items.
+		innerJoin(types, "type").
+		joinOn(innerJoinKind, types, on("items.type", "types.type"))
+	assert.Equal(t, 6, len(res.columns))
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t,
+		[]interface{}{0, 1, 1, "fruit", 1, "fruit"}, res.tuples[0].values,
+	)
+}
+
+func TestJoinOnMultipleKeys(t *testing.T) {
+	left := &relation{
+		columns: []*column{newColumn("l", "a"), newColumn("l", "b")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1, "x"}},
+			&tuple{values: []interface{}{1, "y"}},
+			&tuple{values: []interface{}{2, nil}},
+		},
+	}
+	right := &relation{
+		columns: []*column{newColumn("r", "c"), newColumn("r", "d")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1, "y"}},
+			&tuple{values: []interface{}{2, nil}},
+		},
+	}
+	res := left.joinOn(fullJoinKind, right, on("a", "c"), on("b", "d"))
+	assert.Equal(t, 4, len(res.tuples))
+	assert.Equal(t, []interface{}{1, "x", nil, nil}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, "y", 1, "y"}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{2, nil, nil, nil}, res.tuples[2].values)
+	assert.Equal(t, []interface{}{nil, nil, 2, nil}, res.tuples[3].values)
+}
+
+func TestJoinOnUnknown(t *testing.T) {
+	items, types := joinRelations()
+	res := items.joinOn(innerJoinKind, types, on("type", "types.id"))
+	assert.Equal(t, "types.id", res.err.(*ErrUnknownColumn).Name)
+}
+
+func TestJoinOrderWithDuplicates(t *testing.T) {
+	left := &relation{
+		columns: []*column{newColumn("l", "id"), newColumn("l", "name")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1, "a"}},
+			&tuple{values: []interface{}{2, "b"}},
+			&tuple{values: []interface{}{1, "c"}},
+		},
+	}
+	right := &relation{
+		columns: []*column{newColumn("r", "id"), newColumn("r", "size")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1.0, 10}},
+			&tuple{values: []interface{}{2, 20}},
+			&tuple{values: []interface{}{1, 30}},
+		},
+	}
+	res := left.innerJoin(right, "id")
+	sizes := []interface{}{}
+	for _, tup := range res.tuples {
+		sizes = append(sizes, tup.values[3])
+	}
+	assert.Equal(t, []interface{}{10, 30, 20, 10, 30}, sizes)
+}
+
+func TestMergeJoinUnsorted(t *testing.T) {
+	items, types := joinRelations()
+	res := items.joinWith(mergeJoinStrategy, fullJoinKind, types, on("type", "type"))
+	assert.Equal(t, 6, len(res.tuples))
+	assert.Equal(t, []interface{}{0, 1, 1, "fruit"}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{3, 1, 1, "fruit"}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{1, 2, nil, nil}, res.tuples[2].values)
+	assert.Equal(t, []interface{}{2, nil, nil, nil}, res.tuples[3].values)
+	assert.Equal(t, []interface{}{nil, nil, 3, "fish"}, res.tuples[4].values)
+	assert.Equal(t,
+		[]interface{}{nil, nil, nil, "unknown"}, res.tuples[5].values,
+	)
+}
+
+func TestMergeJoinSameAsHashJoin(t *testing.T) {
+	items, types := joinRelations()
+	items = items.orderBy(sortKey{column: "type", nullsFirst: true})
+	types = types.orderBy("type")
+	for _, kind := range []joinKind{
+		innerJoinKind, leftJoinKind, rightJoinKind, fullJoinKind,
+	} {
+		hashed := items.joinWith(hashJoinStrategy, kind, types, on("type", "type"))
+		merged := items.joinWith(mergeJoinStrategy, kind, types, on("type", "type"))
+		assert.Equal(t, hashed.tuples, merged.tuples)
+	}
+}
+
+func TestMergeJoinSameAsHashJoinLargeNumbers(t *testing.T) {
+	left := &relation{
+		columns: []*column{newColumn("l", "id")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1 << 53}},
+			&tuple{values: []interface{}{1<<53 + 1}},
+			&tuple{values: []interface{}{1 << 60}},
+		},
+	}
+	right := &relation{
+		columns: []*column{newColumn("r", "id")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{float64(1 << 53)}},
+			&tuple{values: []interface{}{float64(1 << 60)}},
+			&tuple{values: []interface{}{float64(1 << 63)}},
+		},
+	}
+	hashed := left.joinWith(hashJoinStrategy, fullJoinKind, right, on("id", "id"))
+	merged := left.joinWith(mergeJoinStrategy, fullJoinKind, right, on("id", "id"))
+	assert.Equal(t, hashed.tuples, merged.tuples)
+	assert.Equal(t, 4, len(hashed.tuples))
+}
+
+func TestMergeJoinDuplicateKeys(t *testing.T) {
+	left := &relation{
+		columns: []*column{newColumn("l", "id")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{2}},
+			&tuple{values: []interface{}{1}},
+			&tuple{values: []interface{}{1.0}},
+		},
+	}
+	right := &relation{
+		columns: []*column{newColumn("r", "id"), newColumn("r", "size")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1, 10}},
+			&tuple{values: []interface{}{"1", 20}},
+			&tuple{values: []interface{}{1, 30}},
+		},
+	}
+	res := left.joinWith(mergeJoinStrategy, innerJoinKind, right, on("id", "id"))
+	assert.Equal(t, 4, len(res.tuples))
+	assert.Equal(t, []interface{}{1, 1, 10}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, 1, 30}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{1.0, 1, 10}, res.tuples[2].values)
+	assert.Equal(t, []interface{}{1.0, 1, 30}, res.tuples[3].values)
+}
+
+func TestSortedOn(t *testing.T) {
+	items, _ := joinRelations()
+	assert.False(t, items.sortedOn([]int{1}))
+	sorted := items.orderBy("type")
+	assert.True(t, sorted.sortedOn([]int{1}))
+	assert.False(t, sorted.sortedOn([]int{0}))
+	assert.True(t, sorted.where(gt(ref("id"), lit(0))).sortedOn([]int{1}))
+	assert.True(t, sorted.selectQ("type").sortedOn([]int{0}))
+	assert.False(t, sorted.selectQ("id").sortedOn([]int{0}))
+}
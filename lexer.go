@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokBlob
+	tokSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of input"
+	case tokString:
+		return "'" + t.text + "'"
+	case tokBlob:
+		return fmt.Sprintf("X'%X'", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// is reports whether the token is the given keyword or symbol.
+// keywords are matched case-insensitively, as SQL does
+func (t token) is(text string) bool {
+	switch t.kind {
+	case tokIdent:
+		return strings.EqualFold(t.text, text)
+	case tokSymbol:
+		return t.text == text
+	}
+	return false
+}
+
+var symbols = []string{
+	"<=", ">=", "<>", "!=",
+	"(", ")", ",", ".", ";", "*", "=", "<", ">", "+", "-", "/",
+}
+
+func lex(src string) ([]token, error) {
+	toks := []token{}
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '-' && strings.HasPrefix(src[i:], "--"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case (c == 'x' || c == 'X') && strings.HasPrefix(src[i+1:], "'"):
+			start := i
+			end := strings.IndexByte(src[i+2:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated blob at %d", start)
+			}
+			b, err := hex.DecodeString(src[i+2 : i+2+end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid blob at %d: %v", start, err)
+			}
+			i += end + 3
+			toks = append(toks, token{tokBlob, string(b), start})
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && isIdentPart(rune(src[i])) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		case c == '"':
+			start := i
+			end := strings.IndexByte(src[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier at %d", start)
+			}
+			i += end + 2
+			toks = append(toks, token{tokIdent, src[start+1 : i-1], start})
+		case '0' <= c && c <= '9':
+			start := i
+			for i < len(src) && '0' <= src[i] && src[i] <= '9' {
+				i++
+			}
+			if i+1 < len(src) && src[i] == '.' &&
+				'0' <= src[i+1] && src[i+1] <= '9' {
+				i++
+				for i < len(src) && '0' <= src[i] && src[i] <= '9' {
+					i++
+				}
+			}
+			toks = append(toks, token{tokNumber, src[start:i], start})
+		case c == '\'':
+			start := i
+			var buf strings.Builder
+			i++
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("unterminated string at %d", start)
+				}
+				if src[i] == '\'' {
+					// a doubled quote is an escaped quote
+					if i+1 < len(src) && src[i+1] == '\'' {
+						buf.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				buf.WriteByte(src[i])
+				i++
+			}
+			toks = append(toks, token{tokString, buf.String(), start})
+		default:
+			sym := ""
+			for _, s := range symbols {
+				if strings.HasPrefix(src[i:], s) {
+					sym = s
+					break
+				}
+			}
+			if sym == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			toks = append(toks, token{tokSymbol, sym, i})
+			i += len(sym)
+		}
+	}
+	toks = append(toks, token{tokEOF, "", len(src)})
+	return toks, nil
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || '0' <= c && c <= '9'
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLexEmpty(t *testing.T) {
+	toks, err := lex("  ")
+	assert.NoError(t, err)
+	assert.Equal(t, []token{{tokEOF, "", 2}}, toks)
+}
+
+func TestLexKinds(t *testing.T) {
+	toks, err := lex("SELECT price FROM items WHERE price <= 250")
+	assert.NoError(t, err)
+	assert.Equal(t, []token{
+		{tokIdent, "SELECT", 0},
+		{tokIdent, "price", 7},
+		{tokIdent, "FROM", 13},
+		{tokIdent, "items", 18},
+		{tokIdent, "WHERE", 24},
+		{tokIdent, "price", 30},
+		{tokSymbol, "<=", 36},
+		{tokNumber, "250", 39},
+		{tokEOF, "", 42},
+	}, toks)
+}
+
+func TestLexNumber(t *testing.T) {
+	toks, err := lex("3.14 1.x")
+	assert.NoError(t, err)
+	assert.Equal(t, token{tokNumber, "3.14", 0}, toks[0])
+	assert.Equal(t, token{tokNumber, "1", 5}, toks[1])
+	assert.Equal(t, token{tokSymbol, ".", 6}, toks[2])
+}
+
+func TestLexString(t *testing.T) {
+	toks, err := lex("'it''s'")
+	assert.NoError(t, err)
+	assert.Equal(t, token{tokString, "it's", 0}, toks[0])
+}
+
+func TestLexUnterminatedString(t *testing.T) {
+	_, err := lex("'apple")
+	assert.Error(t, err)
+}
+
+func TestLexQuotedIdent(t *testing.T) {
+	toks, err := lex(`"select"`)
+	assert.NoError(t, err)
+	assert.Equal(t, token{tokIdent, "select", 0}, toks[0])
+}
+
+func TestLexComment(t *testing.T) {
+	toks, err := lex("1 -- comment\n2")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(toks))
+	assert.Equal(t, "2", toks[1].text)
+}
+
+func TestLexUnknownCharacter(t *testing.T) {
+	_, err := lex("price ? 1")
+	assert.Error(t, err)
+}
+
+func TestTokenIsCaseInsensitive(t *testing.T) {
+	assert.True(t, token{tokIdent, "select", 0}.is("SELECT"))
+	assert.False(t, token{tokString, "select", 0}.is("SELECT"))
+}
+
+func TestLexBlob(t *testing.T) {
+	toks, err := lex("x'00ff' X''")
+	assert.NoError(t, err)
+	assert.Equal(t, token{tokBlob, "\x00\xff", 0}, toks[0])
+	assert.Equal(t, token{tokBlob, "", 8}, toks[1])
+}
+
+func TestLexInvalidBlob(t *testing.T) {
+	_, err := lex("X'0g'")
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// limit keeps the first n tuples
+func (r *relation) limit(n int) *relation {
+	if r.err != nil {
+		return r
+	}
+	if n < 0 {
+		return r.fail(fmt.Errorf("negative limit: %d", n))
+	}
+	if r.rows != nil {
+		// the rows after the first n are not read
+		res := r.filtered(nil)
+		res.rows = func(f func(tup *tuple) error) error {
+			if n == 0 {
+				return nil
+			}
+			i := 0
+			err := r.rows(func(tup *tuple) error {
+				if err := f(tup); err != nil {
+					return err
+				}
+				if i++; i == n {
+					return errStop
+				}
+				return nil
+			})
+			if err == errStop {
+				return nil
+			}
+			return err
+		}
+		return res
+	}
+	if n > len(r.tuples) {
+		n = len(r.tuples)
+	}
+	return r.filtered(r.tuples[:n])
+}
+
+// offset skips the first k tuples
+func (r *relation) offset(k int) *relation {
+	if r.err != nil {
+		return r
+	}
+	if k < 0 {
+		return r.fail(fmt.Errorf("negative offset: %d", k))
+	}
+	if r.rows != nil {
+		i := 0
+		return r.filter(func(tup *tuple) bool {
+			i++
+			return i > k
+		})
+	}
+	if k > len(r.tuples) {
+		k = len(r.tuples)
+	}
+	return r.filtered(r.tuples[k:])
+}
+
+// top is the same as orderBy followed by limit, but keeps only n tuples
+// in a heap while scanning r, instead of sorting all the tuples
+func (r *relation) top(n int, keys ...interface{}) *relation {
+	if r.err != nil {
+		return r
+	}
+	if n < 0 {
+		return r.fail(fmt.Errorf("negative limit: %d", n))
+	}
+	sks, idxs, err := r.resolveSortKeys(keys)
+	if err != nil {
+		return r.fail(err)
+	}
+	h := &topHeap{compare: func(e1, e2 topEntry) int {
+		if c := compareTuples(e1.tup, e2.tup, sks, idxs); c != 0 {
+			return c
+		}
+		// the earlier one goes first among the ties, as the stable sort does
+		return compareInts(e1.seq, e2.seq)
+	}}
+	i := 0
+	err = r.each(func(tup *tuple) error {
+		e := topEntry{tup: tup, seq: i}
+		i++
+		if h.Len() < n {
+			heap.Push(h, e)
+		} else if n > 0 && h.compare(e, h.entries[0]) < 0 {
+			h.entries[0] = e
+			heap.Fix(h, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return r.fail(err)
+	}
+	newTups := make([]*tuple, h.Len())
+	for i := len(newTups) - 1; i >= 0; i-- {
+		newTups[i] = heap.Pop(h).(topEntry).tup
+	}
+	return r.sorted(newTups, sks, idxs)
+}
+
+type topEntry struct {
+	tup *tuple
+	seq int
+}
+
+// topHeap is a max-heap, whose root is the last of the tuples kept
+type topHeap struct {
+	entries []topEntry
+	compare func(e1, e2 topEntry) int
+}
+
+func (h *topHeap) Len() int {
+	return len(h.entries)
+}
+
+func (h *topHeap) Less(i, j int) bool {
+	return h.compare(h.entries[i], h.entries[j]) > 0
+}
+
+func (h *topHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+}
+
+func (h *topHeap) Push(x interface{}) {
+	h.entries = append(h.entries, x.(topEntry))
+}
+
+func (h *topHeap) Pop() interface{} {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return e
+}
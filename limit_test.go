@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func limitRelation() *relation {
+	return &relation{
+		columns: []*column{newColumn("", "id"), newColumn("", "price")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{0, 300}},
+			&tuple{values: []interface{}{1, nil}},
+			&tuple{values: []interface{}{2, 100}},
+			&tuple{values: []interface{}{3, 300}},
+			&tuple{values: []interface{}{4, 200}},
+		},
+	}
+}
+
+func TestLimit(t *testing.T) {
+	res := limitRelation().limit(2)
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, []interface{}{1, nil}, res.tuples[1].values)
+}
+
+func TestLimitOver(t *testing.T) {
+	res := limitRelation().limit(10)
+	assert.Equal(t, 5, len(res.tuples))
+}
+
+func TestLimitNegative(t *testing.T) {
+	res := limitRelation().limit(-1)
+	assert.Error(t, res.err)
+}
+
+func TestOffset(t *testing.T) {
+	res := limitRelation().offset(3)
+	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, []interface{}{3, 300}, res.tuples[0].values)
+	assert.Equal(t, 0, len(limitRelation().offset(10).tuples))
+}
+
+func TestTop(t *testing.T) {
+	res := limitRelation().top(3, sortKey{column: "price", desc: true})
+	assert.Equal(t, 3, len(res.tuples))
+	assert.Equal(t, []interface{}{0, 300}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{3, 300}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{4, 200}, res.tuples[2].values)
+}
+
+func TestTopSameAsOrderBy(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "id"), newColumn("", "type")},
+		tuples:  []*tuple{},
+	}
+	for i := 0; i < 100; i++ {
+		r.tuples = append(r.tuples, newTuple([]interface{}{i, (i * 7) % 5}))
+	}
+	for _, n := range []int{0, 1, 10, 100, 200} {
+		assert.Equal(t,
+			r.orderBy("type").limit(n).tuples, r.top(n, "type").tuples,
+		)
+	}
+}
+
+func TestTopUnknown(t *testing.T) {
+	res := limitRelation().top(1, "unknown")
+	assert.IsType(t, &ErrUnknownColumn{}, res.err)
+}
+
+func TestLimitLazy(t *testing.T) {
+	r := limitRelation()
+	lazy := newRelation(r.columns, nil)
+	lazy.rows = func(f func(tup *tuple) error) error {
+		for i, tup := range r.tuples {
+			if i == 3 {
+				return errors.New("read after the limit")
+			}
+			if err := f(tup); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	res := lazy.offset(1).limit(2).load()
+	assert.NoError(t, res.err)
+	assert.Equal(t, []interface{}{1, 2}, ids(res))
+}
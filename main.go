@@ -2,32 +2,33 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 )
 
-func main() {
+// the tables are saved to the file and reloaded from it at startup,
+// with the mutations since the last checkpoint in the log
+const dbPath = "carameldb.db"
 
-	items := create(
-		"items",
-		[]string{"item_id", "item_name", "type_id", "price"},
-	)
-	items.insert(1, "apple", 1, 300)
-	items.insert(2, "orange", 1, 130)
-	items.insert(3, "cabbage", 2, 200)
-	items.insert(4, "saury", 3, 220)
-	items.insert(5, "seaweed", nil, 250)
-	items.insert(6, "mushroom", 4, 180)
-
-	types := create(
-		"types",
-		[]string{"type_id", "type_name"},
-	)
-	types.insert(1, "fruit")
-	types.insert(2, "vegetable")
-	types.insert(3, "fish")
+func main() {
+	if err := openWAL(dbPath, syncAlways); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer closeWAL()
+	if len(tables) == 0 {
+		if err := createSamples(); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := checkpoint(); err != nil {
+			fmt.Println(err)
+		}
+	}
 
-	fmt.Println(items)
+	fmt.Println(tables["items"])
 	fmt.Println(from("items"))
 	fmt.Println(from("items").selectQ("item_name", "price"))
 	fmt.Println(from("items").lessThan("price", 250))
@@ -39,13 +40,87 @@ func main() {
 			from("types").lessThan("type_id", 3), "type_id",
 		),
 	)
+
+	for _, q := range []string{
+		"SELECT item_name, price FROM items",
+		"SELECT * FROM items WHERE price < 250 ORDER BY price",
+		"SELECT * FROM (SELECT * FROM items WHERE price < 250) " +
+			"LEFT JOIN (SELECT * FROM types WHERE type_id < 3) USING (type_id)",
+		"SELECT type_id, AVG(price) FROM items GROUP BY type_id",
+	} {
+		r, err := query(q)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println(r)
+	}
+}
+
+func createSamples() error {
+	types, err := createTable("types", []columnDef{
+		{"type_id", typeInteger},
+		{"type_name", typeText},
+	}, primaryKey("type_id"))
+	if err != nil {
+		return err
+	}
+	for _, row := range [][]interface{}{
+		{1, "fruit"},
+		{2, "vegetable"},
+		{3, "fish"},
+	} {
+		if err := types.insert(row...); err != nil {
+			return err
+		}
+	}
+
+	items, err := createTable("items", []columnDef{
+		{"item_id", typeInteger},
+		{"item_name", typeText},
+		{"type_id", typeInteger},
+		{"price", typeInteger},
+	},
+		primaryKey("item_id"),
+		autoIncrement("item_id"),
+		references([]string{"type_id"}, "types"),
+		notNull("item_name"),
+		checkExpr(ge(ref("price"), lit(0))),
+	)
+	if err != nil {
+		return err
+	}
+	for _, row := range [][]interface{}{
+		{1, "apple", 1, 300},
+		{2, "orange", 1, 130},
+		{3, "cabbage", 2, 200},
+		{4, "saury", 3, 220},
+		{5, "seaweed", nil, 250},
+	} {
+		if err := items.insert(row...); err != nil {
+			return err
+		}
+	}
+	// the type of mushroom is not in types, which the foreign key rejects
+	err = items.insert(6, "mushroom", 4, 180)
+	if _, ok := err.(*ErrConstraint); !ok {
+		return fmt.Errorf("mushroom should be rejected: %v", err)
+	}
+	fmt.Println(err)
+	return nil
 }
 
 var tables = map[string]*table{}
 
+// column is a column of a relation or a table. only the columns of tables
+// have the constraints, NOT NULL and DEFAULT, whose expression is evaluated
+// for the rows inserted without the value
 type column struct {
-	parent string
-	name   string
+	parent  string
+	name    string
+	typ     colType
+	notNull bool
+	dflt    expr
 }
 
 func newColumn(parent string, name string) *column {
@@ -54,135 +129,261 @@ func newColumn(parent string, name string) *column {
 
 type tuple struct {
 	values []interface{}
+	rid    rowID
 }
 
 func newTuple(vals []interface{}) *tuple {
 	return &tuple{values: vals}
 }
 
+// once an operator fails, the relation carries the error
+// and the succeeding operators pass it through.
+// sortedBy lists the columns which the tuples are known to be ordered on,
+// in ascending order of compareForSort, so that joins can merge them.
+// source is the table which the relation is the scan of, at the version,
+// so that the operators can use its indexes instead of the tuples.
+// a lazy relation has rows instead of the tuples, which reads them
+// one at a time, so that the operators passing over them once
+// do not hold all of them in the memory
 type relation struct {
-	columns []*column
-	tuples  []*tuple
+	columns  []*column
+	tuples   []*tuple
+	rows     func(f func(tup *tuple) error) error
+	err      error
+	sortedBy []*column
+	source   *table
+	version  int
 }
 
 func newRelation(cols []*column, tups []*tuple) *relation {
 	return &relation{columns: cols, tuples: tups}
 }
 
+// filtered makes a relation of some of the tuples of r in the same order
+func (r *relation) filtered(tups []*tuple) *relation {
+	res := newRelation(r.columns, tups)
+	res.sortedBy = r.sortedBy
+	return res
+}
+
+// errStop stops reading the rows of a lazy relation
+var errStop = errors.New("stop")
+
+// each calls f with the tuples of r in order
+func (r *relation) each(f func(tup *tuple) error) error {
+	if r.rows != nil {
+		return r.rows(f)
+	}
+	for _, tup := range r.tuples {
+		if err := f(tup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load reads all the tuples of a lazy relation,
+// for the operators which need them at once
+func (r *relation) load() *relation {
+	if r.err != nil || r.rows == nil {
+		return r
+	}
+	tups := []*tuple{}
+	err := r.rows(func(tup *tuple) error {
+		tups = append(tups, tup)
+		return nil
+	})
+	if err != nil {
+		return r.fail(err)
+	}
+	res := *r
+	res.tuples, res.rows = tups, nil
+	return &res
+}
+
+// mapped makes a relation of the tuples which f makes of those of r,
+// skipping the ones for which it returns nil. it is lazy if r is
+func (r *relation) mapped(cols []*column, f func(tup *tuple) *tuple) *relation {
+	if r.rows == nil {
+		newTups := []*tuple{}
+		for _, tup := range r.tuples {
+			if newTup := f(tup); newTup != nil {
+				newTups = append(newTups, newTup)
+			}
+		}
+		return newRelation(cols, newTups)
+	}
+	res := newRelation(cols, nil)
+	res.rows = func(g func(tup *tuple) error) error {
+		return r.rows(func(tup *tuple) error {
+			if newTup := f(tup); newTup != nil {
+				return g(newTup)
+			}
+			return nil
+		})
+	}
+	return res
+}
+
+// filter keeps the tuples for which keep is true in the same order
+func (r *relation) filter(keep func(tup *tuple) bool) *relation {
+	res := r.mapped(r.columns, func(tup *tuple) *tuple {
+		if keep(tup) {
+			return tup
+		}
+		return nil
+	})
+	res.sortedBy = r.sortedBy
+	return res
+}
+
+func hasColumn(cols []*column, c *column) bool {
+	for _, col := range cols {
+		if col == c {
+			return true
+		}
+	}
+	return false
+}
+
 // TODO: rewrite by interfaces
-//       this implementation is to use immediate string values as arguments
+//
+//	this implementation is to use immediate string values as arguments
 func from(x interface{}) *relation {
 	if r, ok := x.(*relation); ok {
 		return r
 	}
-	tblName := fmt.Sprint(x)
-	t := tables[tblName]
+	t, ok := x.(*table)
+	if !ok {
+		var err error
+		if t, err = lookupTable(fmt.Sprint(x)); err != nil {
+			return newRelation([]*column{}, []*tuple{}).fail(err)
+		}
+	}
 	cols := []*column{}
 	for _, c := range t.columns {
-		cols = append(cols, newColumn(tblName, c.name))
+		col := newColumn(t.name, c.name)
+		col.typ = c.typ
+		cols = append(cols, col)
+	}
+	if _, ok := t.store.(*heapFile); ok {
+		// a paged table may not fit in the memory,
+		// so it is read from the pages as the operators need
+		res := newRelation(cols, nil)
+		res.source, res.version = t, t.version
+		version := t.version
+		res.rows = func(f func(tup *tuple) error) error {
+			if t.version != version {
+				return fmt.Errorf("%s: modified since scanned", t.name)
+			}
+			return t.store.scan(f)
+		}
+		return res
+	}
+	tups, err := t.scan()
+	if err != nil {
+		return newRelation(cols, []*tuple{}).fail(err)
 	}
-	return newRelation(cols, t.tuples)
+	res := newRelation(cols, tups)
+	res.source, res.version = t, t.version
+	return res
 }
 
+// findColumn also resolves a name qualified by the parent, e.g. items.price,
+// which distinguishes the columns of the same name after joins
 func (r *relation) findColumn(name string) int {
 	for i, c := range r.columns {
 		if c.name == name {
 			return i
 		}
 	}
+	if dot := strings.Index(name, "."); dot >= 0 {
+		parent, colName := name[:dot], name[dot+1:]
+		for i, c := range r.columns {
+			if c.parent == parent && c.name == colName {
+				return i
+			}
+		}
+	}
 	// we can simplify checking the existence of n in r,
 	// by r.findColumn(n) <= len(r.columns) before random accesses
 	return len(r.columns)
 }
 
 func (r *relation) selectQ(colNames ...string) *relation {
+	if r.err != nil {
+		return r
+	}
 	idxs := []int{}
 	newCols := []*column{}
 	for _, cn := range colNames {
-		idx := r.findColumn(cn)
-		idxs = append(idxs, idx)
-		if idx < len(r.columns) {
-			newCols = append(newCols, r.columns[idx])
+		idx, err := r.lookupColumn(cn)
+		if err != nil {
+			return r.fail(err)
 		}
+		idxs = append(idxs, idx)
+		newCols = append(newCols, r.columns[idx])
 	}
-	newTups := []*tuple{}
-	for _, tup := range r.tuples {
+	res := r.mapped(newCols, func(tup *tuple) *tuple {
 		vals := []interface{}{}
 		for _, idx := range idxs {
-			// TODO: Can I avoid to refer the nil pointer?
-			if idx < len(tup.values) {
-				vals = append(vals, tup.values[idx])
-			} else {
-				vals = append(vals, nil)
-			}
+			vals = append(vals, tup.values[idx])
 		}
-		newTups = append(newTups, newTuple(vals))
-	}
-	return newRelation(newCols, newTups)
-}
-
-func (r *relation) leftJoin(x interface{}, colName string) *relation {
-	j := from(x)
-	newCols := []*column{}
-	newCols = append(newCols, r.columns...)
-	newCols = append(newCols, j.columns...)
-	rIdx := r.findColumn(colName)
-	if len(r.columns) <= rIdx {
-		return newRelation(newCols, []*tuple{})
-	}
-	newTups := []*tuple{}
-	for _, rTup := range r.tuples {
-		keyVal := rTup.values[rIdx]
-		jRel := j.equal(colName, keyVal)
-		if len(jRel.tuples) == 0 {
-			vals := []interface{}{}
-			vals = append(vals, rTup.values...)
-			for len(vals) < len(newCols) {
-				vals = append(vals, nil)
-			}
-			newTups = append(newTups, newTuple(vals))
-		}
-		for _, jTup := range jRel.tuples {
-			vals := []interface{}{}
-			vals = append(vals, rTup.values...)
-			vals = append(vals, jTup.values...)
-			newTups = append(newTups, newTuple(vals))
+		return newTuple(vals)
+	})
+	// the order is kept as far as the sorted columns are selected
+	for _, c := range r.sortedBy {
+		if !hasColumn(newCols, c) {
+			break
 		}
+		res.sortedBy = append(res.sortedBy, c)
 	}
-	return newRelation(newCols, newTups)
+	return res
 }
 
 func (r *relation) lessThan(colName string, n int) *relation {
-	idx := r.findColumn(colName)
-	if idx >= len(r.columns) {
-		return newRelation(r.columns, []*tuple{})
+	if r.err != nil {
+		return r
 	}
-	newTups := []*tuple{}
-	for _, tup := range r.tuples {
-		v, ok := tup.values[idx].(int)
-		if ok && v < n {
-			newTups = append(newTups, tup)
-		}
+	idx, err := r.lookupColumn(colName)
+	if err != nil {
+		return r.fail(err)
+	}
+	if ix := r.indexFor(idx, false); ix != nil {
+		return r.indexed(ix, keyRange{high: n})
 	}
-	return newRelation(r.columns, newTups)
+	// NULLs are never less than anything
+	return r.filter(func(tup *tuple) bool {
+		c, ok := compareValues(tup.values[idx], n)
+		return ok && c < 0
+	})
 }
 
 func (r *relation) equal(colName string, key interface{}) *relation {
+	if r.err != nil {
+		return r
+	}
+	idx, err := r.lookupColumn(colName)
+	if err != nil {
+		return r.fail(err)
+	}
+	// NULL is equal to nothing, even to NULL itself.
 	// null check should be by isNull condition
 	if key == nil {
 		return newRelation(r.columns, []*tuple{})
 	}
-	idx := r.findColumn(colName)
-	if idx >= len(r.columns) {
-		return newRelation(r.columns, []*tuple{})
+	if ix := r.indexFor(idx, true); ix != nil {
+		return r.indexed(ix, pointRange(key))
 	}
-	newTups := []*tuple{}
-	for _, tup := range r.tuples {
-		if tup.values[idx] == key {
-			newTups = append(newTups, tup)
-		}
+	if tups, ok, err := r.lookup(idx, key); err != nil {
+		return r.fail(err)
+	} else if ok {
+		return r.filtered(tups)
 	}
-	return newRelation(r.columns, newTups)
+	return r.filter(func(tup *tuple) bool {
+		c, ok := compareValues(tup.values[idx], key)
+		return ok && c == 0
+	})
 }
 
 type tupleSorter struct {
@@ -202,43 +403,88 @@ func (ts *tupleSorter) Less(i, j int) bool {
 	return ts.compare(ts.tuples[i], ts.tuples[j])
 }
 
-func (r *relation) orderBy(colName string) *relation {
-	idx := r.findColumn(colName)
-	if idx >= len(r.columns) {
+// sortKey specifies the direction and where NULLs are placed
+// in ordering by the column. NULLs are placed last unless nullsFirst,
+// in either direction. orderBy also takes a bare column name,
+// which sorts in ascending order with NULLs last
+type sortKey struct {
+	column     string
+	desc       bool
+	nullsFirst bool
+}
+
+// orderBy sorts the tuples by the keys, the first of them most significant.
+// the sort is stable, so the ties stay in the same order as in r
+func (r *relation) orderBy(keys ...interface{}) *relation {
+	if r.err != nil {
 		return r
 	}
+	sks, idxs, err := r.resolveSortKeys(keys)
+	if err != nil {
+		return r.fail(err)
+	}
 	compare := func(t1, t2 *tuple) bool {
-		n1, ok1 := t1.values[idx].(int)
-		n2, ok2 := t2.values[idx].(int)
-		if ok1 && ok2 {
-			return n1 < n2
-		}
-		s1, ok1 := t1.values[idx].(string)
-		s2, ok2 := t2.values[idx].(string)
-		if ok1 && ok2 {
-			return s1 < s2
-		}
-		return true
+		return compareTuples(t1, t2, sks, idxs) < 0
+	}
+	if r = r.load(); r.err != nil {
+		return r
 	}
 	newTups := []*tuple{}
 	newTups = append(newTups, r.tuples...)
 	ts := &tupleSorter{tuples: newTups, compare: compare}
-	sort.Sort(ts)
-	return newRelation(r.columns, ts.tuples)
+	sort.Stable(ts)
+	return r.sorted(ts.tuples, sks, idxs)
 }
 
-type aggregator interface {
-	name() string
-	add()
-	result() interface{}
-	reset()
+func (r *relation) resolveSortKeys(keys []interface{}) ([]sortKey, []int, error) {
+	sks := []sortKey{}
+	idxs := []int{}
+	for _, key := range keys {
+		sk, ok := key.(sortKey)
+		if !ok {
+			sk = sortKey{column: fmt.Sprint(key)}
+		}
+		idx, err := r.lookupColumn(sk.column)
+		if err != nil {
+			return nil, nil, err
+		}
+		sks = append(sks, sk)
+		idxs = append(idxs, idx)
+	}
+	return sks, idxs, nil
 }
 
-func (r *relation) groupBy(colName string, aggs ...aggregator) *relation {
-	return nil
+func compareTuples(t1, t2 *tuple, sks []sortKey, idxs []int) int {
+	for i, sk := range sks {
+		v1, v2 := t1.values[idxs[i]], t2.values[idxs[i]]
+		c := compareForSort(v1, v2, sk.nullsFirst)
+		if sk.desc && v1 != nil && v2 != nil {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// sorted makes a relation of the tuples of r sorted by the keys.
+// joins can merge the relation on the leading ascending keys
+func (r *relation) sorted(tups []*tuple, sks []sortKey, idxs []int) *relation {
+	res := newRelation(r.columns, tups)
+	for i, sk := range sks {
+		if sk.desc {
+			break
+		}
+		res.sortedBy = append(res.sortedBy, r.columns[idxs[i]])
+	}
+	return res
 }
 
 func (r *relation) String() string {
+	if r.err != nil {
+		return "error: " + r.err.Error() + "\n"
+	}
 	var buf bytes.Buffer
 	for _, c := range r.columns {
 		buf.WriteByte('|')
@@ -249,40 +495,300 @@ func (r *relation) String() string {
 		buf.WriteString(c.name)
 	}
 	buf.WriteString("|\n")
-	for _, t := range r.tuples {
+	err := r.each(func(t *tuple) error {
 		for _, v := range t.values {
 			buf.WriteByte('|')
 			buf.WriteString(fmt.Sprint(v))
 		}
 		buf.WriteString("|\n")
+		return nil
+	})
+	if err != nil {
+		return "error: " + err.Error() + "\n"
 	}
 	return buf.String()
 }
 
+// table is a schema and the storage which keeps the rows of it.
+// version counts the mutations, by which the relations scanned
+// from the table know whether its indexes still match them
 type table struct {
-	relation
-	name string
+	name        string
+	columns     []*column
+	store       storage
+	indexes     []*index
+	keys        []*uniqueKey
+	foreignKeys []*foreignKey
+	checks      []*checkConstraint
+	sequences   []*sequence
+	version     int
 }
 
+// newTable makes a table kept in memory
 func newTable(name string, cols []*column) *table {
-	t := &table{}
-	t.name = name
-	t.columns = cols
-	t.tuples = []*tuple{}
-	return t
+	return &table{name: name, columns: cols, store: newMemStore()}
 }
 
-func create(name string, colNames []string) *table {
-	cols := []*column{}
+// create registers a table of untyped columns with the constraints
+func create(
+	name string, colNames []string, cons ...constraintDef,
+) (*table, error) {
+	defs := []columnDef{}
 	for _, cn := range colNames {
-		cols = append(cols, newColumn("", cn))
+		defs = append(defs, columnDef{cn, typeAny})
 	}
-	t := newTable(name, cols)
-	tables[name] = t
-	return t
+	return createTable(name, defs, cons...)
 }
 
-func (t *table) insert(vals ...interface{}) *table {
-	t.tuples = append(t.tuples, newTuple(vals))
-	return t
+func (t *table) scan() ([]*tuple, error) {
+	tups := []*tuple{}
+	err := t.store.scan(func(tup *tuple) error {
+		tups = append(tups, tup)
+		return nil
+	})
+	return tups, err
+}
+
+func (t *table) lookupColumn(name string) (int, error) {
+	return newRelation(t.columns, nil).lookupColumn(name)
+}
+
+func (t *table) String() string {
+	tups, err := t.scan()
+	if err != nil {
+		return newRelation(t.columns, nil).fail(err).String()
+	}
+	return newRelation(t.columns, tups).String()
+}
+
+func (t *table) insert(vals ...interface{}) error {
+	row, err := t.validate(vals)
+	if err != nil {
+		return err
+	}
+	rows := [][]interface{}{row}
+	if err := t.check(nil, rows); err != nil {
+		return err
+	}
+	return t.insertRows(rows)
+}
+
+// insertRows stores the rows validated and checked in advance, all or none
+// of them. they are logged at once, so that a crash never replays some of
+// them, and the rows inserted are deleted again if any of them fails
+func (t *table) insertRows(rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	recs := [][]byte{}
+	for _, row := range rows {
+		recs = append(recs, insertRecord(t.name, row).Bytes())
+	}
+	rec := bytes.NewBuffer(recs[0])
+	if len(recs) > 1 {
+		rec = batchRecord(recs)
+	}
+	if err := journal.logTable(t, rec); err != nil {
+		return err
+	}
+	tups := []*tuple{}
+	for _, row := range rows {
+		tup, err := t.insertRow(row)
+		if tup != nil {
+			tups = append(tups, tup)
+		}
+		if err != nil {
+			for _, tup := range tups {
+				t.deleteRow(tup)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// insertNamed inserts a row of the named values,
+// where the other columns have their default values
+func (t *table) insertNamed(set map[string]interface{}) error {
+	vals, err := t.defaultRow()
+	if err != nil {
+		return err
+	}
+	for cn, v := range set {
+		idx, err := t.lookupColumn(cn)
+		if err != nil {
+			return err
+		}
+		vals[idx] = v
+	}
+	return t.insert(vals...)
+}
+
+// insertRow, updateRow and deleteRow apply the mutations to the storage
+// and the indexes, both for the statements and for the replay of the log.
+// cur is the tuple of the row currently in the storage
+func (t *table) insertRow(row []interface{}) (*tuple, error) {
+	tup, err := t.store.insert(row)
+	if err != nil {
+		return nil, err
+	}
+	for _, ix := range t.indexes {
+		ix.add(tup)
+	}
+	t.advanceSequences(row)
+	t.version++
+	return tup, t.saveSequences()
+}
+
+func (t *table) updateRow(cur *tuple, row []interface{}) (*tuple, error) {
+	tup, err := t.store.update(cur.rid, row)
+	if err != nil {
+		return nil, err
+	}
+	for _, ix := range t.indexes {
+		ix.remove(cur)
+		ix.add(tup)
+	}
+	t.advanceSequences(row)
+	t.version++
+	return tup, t.saveSequences()
+}
+
+func (t *table) deleteRow(cur *tuple) error {
+	if err := t.store.delete(cur.rid); err != nil {
+		return err
+	}
+	for _, ix := range t.indexes {
+		ix.remove(cur)
+	}
+	t.version++
+	return nil
+}
+
+// drop unregisters the table and closes its storage.
+// the table kept by its own file can be opened again
+func drop(name string) bool {
+	t, ok := tables[name]
+	if !ok {
+		return false
+	}
+	if _, ok := t.store.(*memStore); ok {
+		journal.log(dropRecord(name))
+	}
+	t.closeSequences()
+	t.store.close()
+	delete(tables, name)
+	return true
+}
+
+// update replaces the rows of the given tuples, which are scanned from t,
+// by their copies in which the named columns are set to the new values
+func (t *table) update(tups []*tuple, set map[string]interface{}) (int, error) {
+	idxs := map[int]interface{}{}
+	for cn, v := range set {
+		idx, err := t.lookupColumn(cn)
+		if err != nil {
+			return 0, err
+		}
+		v, err := t.columns[idx].typ.convert(v)
+		if err != nil {
+			return 0, fmt.Errorf("%s.%s: %v", t.name, cn, err)
+		}
+		idxs[idx] = v
+	}
+	curs, err := t.existingRows(tups)
+	if err != nil {
+		return 0, err
+	}
+	rids := []rowID{}
+	rows := [][]interface{}{}
+	for _, cur := range curs {
+		vals := []interface{}{}
+		vals = append(vals, cur.values...)
+		for idx, v := range idxs {
+			vals[idx] = v
+		}
+		rids = append(rids, cur.rid)
+		rows = append(rows, vals)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if err := t.check(curs, rows); err != nil {
+		return 0, err
+	}
+	if err := t.checkReferenced(curs, rows); err != nil {
+		return 0, err
+	}
+	if err := journal.logTable(t, updateRecord(t.name, rids, rows)); err != nil {
+		return 0, err
+	}
+	for i, cur := range curs {
+		if _, err := t.updateRow(cur, rows[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(rows), nil
+}
+
+// delete removes the rows of the given tuples, which are scanned from t,
+// and then applies the actions of the foreign keys referencing them
+func (t *table) delete(tups []*tuple) (int, error) {
+	curs, err := t.existingRows(tups)
+	if err != nil {
+		return 0, err
+	}
+	if len(curs) == 0 {
+		return 0, nil
+	}
+	if err := t.checkDelete(curs, map[*table]map[rowID]bool{}); err != nil {
+		return 0, err
+	}
+	rids := []rowID{}
+	for _, cur := range curs {
+		rids = append(rids, cur.rid)
+	}
+	del := func() error {
+		if err := journal.logTable(t, deleteRecord(t.name, rids)); err != nil {
+			return err
+		}
+		for _, cur := range curs {
+			if err := t.deleteRow(cur); err != nil {
+				return err
+			}
+		}
+		return t.applyDeleteActions(curs)
+	}
+	// the rows and those referencing them are deleted at once
+	if t.hasDeleteActions() {
+		err = atomically(del)
+	} else {
+		err = del()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(curs), nil
+}
+
+// existingRows returns the current tuples of the distinct rows
+// of the given tuples. the tuples of the rows already deleted are ignored
+func (t *table) existingRows(tups []*tuple) ([]*tuple, error) {
+	curs := []*tuple{}
+	seen := map[rowID]bool{}
+	for _, tup := range tups {
+		if tup.rid == noRowID || seen[tup.rid] {
+			continue
+		}
+		seen[tup.rid] = true
+		cur, err := t.store.fetch(tup.rid)
+		if err == errNoRow {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		curs = append(curs, cur)
+	}
+	return curs, nil
 }
@@ -34,13 +34,28 @@ func TestFindColumnNotFound(t *testing.T) {
 	)
 }
 
+func TestFindColumnQualified(t *testing.T) {
+	r := &relation{
+		columns: []*column{
+			newColumn("items", "id"),
+			newColumn("types", "id"),
+			newColumn("", "sum(items.price)"),
+		},
+	}
+	assert.Equal(t, 0, r.findColumn("id"))
+	assert.Equal(t, 0, r.findColumn("items.id"))
+	assert.Equal(t, 1, r.findColumn("types.id"))
+	assert.Equal(t, 2, r.findColumn("sum(items.price)"))
+	assert.Equal(t, 3, r.findColumn("other.id"))
+}
+
 func TestCreateRegistered(t *testing.T) {
 	create("TestCreateRegistered", []string{"col_name"})
 	tbl := tables["TestCreateRegistered"]
 	if assert.NotNil(t, tbl) {
 		assert.Equal(t, "TestCreateRegistered", tbl.name)
 		assert.Equal(t, []*column{newColumn("", "col_name")}, tbl.columns)
-		assert.Equal(t, []*tuple{}, tbl.tuples)
+		assert.Equal(t, []*tuple{}, from(tbl).tuples)
 	}
 }
 
@@ -51,22 +66,25 @@ func TestCreateNotRegistered(t *testing.T) {
 }
 
 func TestInsertTrivial(t *testing.T) {
-	tbl := &table{name: "tbl_name"}
-	newTbl := tbl.insert()
-	assert.Equal(t, tbl, newTbl)
+	tbl := newTable("tbl_name", nil)
+	err := tbl.insert()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(from(tbl).tuples))
 }
 
 func TestInsertOrdered(t *testing.T) {
-	tbl := &table{name: "tbl_name"}
+	tbl := newTable("tbl_name", nil)
 	tbl.columns = []*column{newColumn("", "id")}
-	tbl.insert(0).insert(1).insert(2)
-	assert.Equal(t, 0, tbl.tuples[0].values[0])
-	assert.Equal(t, 1, tbl.tuples[1].values[0])
-	assert.Equal(t, 2, tbl.tuples[2].values[0])
+	tbl.insert(0)
+	tbl.insert(1)
+	tbl.insert(2)
+	assert.Equal(t, 0, from(tbl).tuples[0].values[0])
+	assert.Equal(t, 1, from(tbl).tuples[1].values[0])
+	assert.Equal(t, 2, from(tbl).tuples[2].values[0])
 }
 
 func TestFromEmpty(t *testing.T) {
-	tbl := create("TestFromEmpty", []string{"id"})
+	tbl, _ := create("TestFromEmpty", []string{"id"})
 	r := from("TestFromEmpty")
 	assert.Equal(t, 1, len(r.columns))
 	assert.Equal(t, newColumn("TestFromEmpty", "id"), r.columns[0])
@@ -75,13 +93,29 @@ func TestFromEmpty(t *testing.T) {
 }
 
 func TestFromAfterInsert(t *testing.T) {
-	tbl := create("TestFromAfterInsert", []string{"id"})
-	tbl.insert(0).insert(1).insert(2)
+	tbl, _ := create("TestFromAfterInsert", []string{"id"})
+	tbl.insert(0)
+	tbl.insert(1)
+	tbl.insert(2)
 	r := from("TestFromAfterInsert")
 	assert.Equal(t, 1, len(r.columns))
 	assert.Equal(t, newColumn("TestFromAfterInsert", "id"), r.columns[0])
 	assert.Equal(t, tbl.columns[0].name, r.columns[0].name)
-	assert.Equal(t, tbl.tuples, r.tuples)
+	assert.Equal(t, from(tbl).tuples, r.tuples)
+}
+
+func TestFromTyped(t *testing.T) {
+	createTable("TestFromTyped", []columnDef{{"id", typeInteger}})
+	r := from("TestFromTyped")
+	assert.Equal(t, "TestFromTyped", r.columns[0].parent)
+	assert.Equal(t, typeInteger, r.columns[0].typ)
+}
+
+func TestFromUnknown(t *testing.T) {
+	r := from("TestFromUnknown")
+	assert.Equal(t, &ErrUnknownTable{Name: "TestFromUnknown"}, r.err)
+	assert.Equal(t, 0, len(r.columns))
+	assert.Equal(t, 0, len(r.tuples))
 }
 
 func TestFromByRelation(t *testing.T) {
@@ -120,8 +154,10 @@ func TestSelectQUnknown(t *testing.T) {
 		},
 	}
 	res := r.selectQ("unknown")
-	assert.Equal(t, 0, len(res.columns))
-	assert.Equal(t, 2, len(res.tuples))
+	assert.Equal(t, &ErrUnknownColumn{
+		Name: "unknown", Available: []string{"id", "str"},
+	}, res.err)
+	assert.Equal(t, 0, len(res.tuples))
 }
 
 func TestSelectQProper(t *testing.T) {
@@ -161,6 +197,12 @@ func TestLessThanUnknown(t *testing.T) {
 	res := r.lessThan("unknown", 0)
 	assert.Equal(t, r.columns, res.columns)
 	assert.Equal(t, 0, len(res.tuples))
+	assert.IsType(t, &ErrUnknownColumn{}, res.err)
+}
+
+func TestLessThanPropagated(t *testing.T) {
+	res := from("TestLessThanPropagated").lessThan("id", 0)
+	assert.IsType(t, &ErrUnknownTable{}, res.err)
 }
 
 func TestLessThanNone(t *testing.T) {
@@ -176,6 +218,20 @@ func TestLessThanNone(t *testing.T) {
 	assert.Equal(t, 0, len(res.tuples))
 }
 
+func TestLessThanNull(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "price")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{nil}},
+			&tuple{values: []interface{}{0.5}},
+			&tuple{values: []interface{}{"0"}},
+		},
+	}
+	res := r.lessThan("price", 1)
+	assert.Equal(t, 1, len(res.tuples))
+	assert.Equal(t, []interface{}{0.5}, res.tuples[0].values)
+}
+
 func TestLessThanProper(t *testing.T) {
 	r := &relation{
 		columns: []*column{newColumn("", "id")},
@@ -201,6 +257,7 @@ func TestEqualUnknown(t *testing.T) {
 	res := r.equal("unknown", "foo")
 	assert.Equal(t, r.columns, res.columns)
 	assert.Equal(t, 0, len(res.tuples))
+	assert.IsType(t, &ErrUnknownColumn{}, res.err)
 }
 
 func TesTEqualNone(t *testing.T) {
@@ -216,6 +273,15 @@ func TesTEqualNone(t *testing.T) {
 	assert.Equal(t, 0, len(res.tuples))
 }
 
+func TestEqualPropagated(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "name")},
+		tuples:  []*tuple{},
+	}
+	res := r.equal("unknown", "foo").equal("name", "foo")
+	assert.Equal(t, "unknown", res.err.(*ErrUnknownColumn).Name)
+}
+
 func TestEqualTypeMismatch(t *testing.T) {
 	r := &relation{
 		columns: []*column{newColumn("", "name")},
@@ -229,6 +295,31 @@ func TestEqualTypeMismatch(t *testing.T) {
 	assert.Equal(t, 0, len(res.tuples))
 }
 
+func TestEqualNull(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "name")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{nil}},
+			&tuple{values: []interface{}{"one"}},
+		},
+	}
+	res := r.equal("name", nil)
+	assert.Equal(t, 0, len(res.tuples), "NULL should equal nothing")
+}
+
+func TestEqualNumeric(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "price")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{1}},
+			&tuple{values: []interface{}{1.0}},
+			&tuple{values: []interface{}{[]byte{1}}},
+		},
+	}
+	res := r.equal("price", 1)
+	assert.Equal(t, 2, len(res.tuples))
+}
+
 func TestEqualProper(t *testing.T) {
 	r := &relation{
 		columns: []*column{newColumn("", "name")},
@@ -253,7 +344,8 @@ func TestOrderByUnknown(t *testing.T) {
 		},
 	}
 	res := r.orderBy("unknown")
-	assert.Equal(t, r, res)
+	assert.Equal(t, r.columns, res.columns)
+	assert.IsType(t, &ErrUnknownColumn{}, res.err)
 }
 
 func TestOrderByNone(t *testing.T) {
@@ -329,6 +421,100 @@ func TestOrderByProperByString(t *testing.T) {
 	assert.Equal(t, []interface{}{0, "zero"}, res.tuples[2].values)
 }
 
+func TestOrderByNullsLast(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "id"), newColumn("", "size")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{0, nil}},
+			&tuple{values: []interface{}{1, 200}},
+			&tuple{values: []interface{}{2, "big"}},
+			&tuple{values: []interface{}{3, 100.5}},
+		},
+	}
+	res := r.orderBy("size")
+	assert.Equal(t, []interface{}{3, 100.5}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, 200}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{2, "big"}, res.tuples[2].values)
+	assert.Equal(t, []interface{}{0, nil}, res.tuples[3].values)
+}
+
+func TestOrderByNullsFirst(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "id"), newColumn("", "size")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{0, 100}},
+			&tuple{values: []interface{}{1, nil}},
+		},
+	}
+	res := r.orderBy(sortKey{column: "size", nullsFirst: true})
+	assert.Equal(t, []interface{}{1, nil}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{0, 100}, res.tuples[1].values)
+}
+
+func TestOrderByDesc(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "id"), newColumn("", "size")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{0, 100}},
+			&tuple{values: []interface{}{1, nil}},
+			&tuple{values: []interface{}{2, 300}},
+		},
+	}
+	res := r.orderBy(sortKey{column: "size", desc: true})
+	assert.Equal(t, []interface{}{2, 300}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{0, 100}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{1, nil}, res.tuples[2].values)
+}
+
+func TestOrderByDescNullsFirst(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "id"), newColumn("", "size")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{0, 100}},
+			&tuple{values: []interface{}{1, nil}},
+			&tuple{values: []interface{}{2, 300}},
+		},
+	}
+	res := r.orderBy(sortKey{column: "size", desc: true, nullsFirst: true})
+	assert.Equal(t, []interface{}{1, nil}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{2, 300}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{0, 100}, res.tuples[2].values)
+}
+
+func TestOrderByMultipleKeys(t *testing.T) {
+	r := &relation{
+		columns: []*column{
+			newColumn("", "id"), newColumn("", "type"), newColumn("", "price"),
+		},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{0, 2, 100}},
+			&tuple{values: []interface{}{1, 1, 100}},
+			&tuple{values: []interface{}{2, 2, 300}},
+			&tuple{values: []interface{}{3, 1, 200}},
+		},
+	}
+	res := r.orderBy("type", sortKey{column: "price", desc: true})
+	assert.Equal(t, []interface{}{3, 1, 200}, res.tuples[0].values)
+	assert.Equal(t, []interface{}{1, 1, 100}, res.tuples[1].values)
+	assert.Equal(t, []interface{}{2, 2, 300}, res.tuples[2].values)
+	assert.Equal(t, []interface{}{0, 2, 100}, res.tuples[3].values)
+}
+
+func TestOrderByStable(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "id"), newColumn("", "type")},
+		tuples:  []*tuple{},
+	}
+	for i := 0; i < 100; i++ {
+		r.tuples = append(r.tuples, newTuple([]interface{}{i, i % 2}))
+	}
+	res := r.orderBy("type")
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, []interface{}{2 * i, 0}, res.tuples[i].values)
+		assert.Equal(t, []interface{}{2*i + 1, 1}, res.tuples[50+i].values)
+	}
+}
+
 func TestLeftJoinLeftUnknown(t *testing.T) {
 	r := &relation{
 		columns: []*column{newColumn("", "id"), newColumn("", "name")},
@@ -336,11 +522,12 @@ func TestLeftJoinLeftUnknown(t *testing.T) {
 			&tuple{values: []interface{}{0, "zero"}},
 		},
 	}
-	tbl := create("TestLeftJoinLeftUnknown", []string{"id", "size"})
+	tbl, _ := create("TestLeftJoinLeftUnknown", []string{"id", "size"})
 	tbl.insert(0, 100)
 	res := r.leftJoin("TestLeftJoinLeftUnknown", "size")
 	assert.Equal(t, 4, len(res.columns))
 	assert.Equal(t, 0, len(res.tuples))
+	assert.IsType(t, &ErrUnknownColumn{}, res.err)
 }
 
 func TestLeftJoinLeftUnknownByRelation(t *testing.T) {
@@ -359,6 +546,18 @@ func TestLeftJoinLeftUnknownByRelation(t *testing.T) {
 	res := r1.leftJoin(r2, "size")
 	assert.Equal(t, 4, len(res.columns))
 	assert.Equal(t, 0, len(res.tuples))
+	assert.IsType(t, &ErrUnknownColumn{}, res.err)
+}
+
+func TestLeftJoinRightUnknownTable(t *testing.T) {
+	r := &relation{
+		columns: []*column{newColumn("", "id"), newColumn("", "name")},
+		tuples: []*tuple{
+			&tuple{values: []interface{}{0, "zero"}},
+		},
+	}
+	res := r.leftJoin("TestLeftJoinRightUnknownTable", "id")
+	assert.IsType(t, &ErrUnknownTable{}, res.err)
 }
 
 func TestLeftJoinRightUnknown(t *testing.T) {
@@ -368,12 +567,12 @@ func TestLeftJoinRightUnknown(t *testing.T) {
 			&tuple{values: []interface{}{0, "zero"}},
 		},
 	}
-	tbl := create("TestLeftJoinRightUnknown", []string{"id", "size"})
+	tbl, _ := create("TestLeftJoinRightUnknown", []string{"id", "size"})
 	tbl.insert(0, 100)
-	res := r.leftJoin("TestLeftJoinLeftUnknown", "name")
+	res := r.leftJoin("TestLeftJoinRightUnknown", "name")
 	assert.Equal(t, 4, len(res.columns))
-	assert.Equal(t, 1, len(res.tuples))
-	assert.Equal(t, []interface{}{0, "zero", nil, nil}, res.tuples[0].values)
+	assert.Equal(t, 0, len(res.tuples))
+	assert.IsType(t, &ErrUnknownColumn{}, res.err)
 }
 
 func TestLeftJoinRightUnknownByRelation(t *testing.T) {
@@ -391,8 +590,8 @@ func TestLeftJoinRightUnknownByRelation(t *testing.T) {
 	}
 	res := r1.leftJoin(r2, "name")
 	assert.Equal(t, 4, len(res.columns))
-	assert.Equal(t, 1, len(res.tuples))
-	assert.Equal(t, []interface{}{0, "zero", nil, nil}, res.tuples[0].values)
+	assert.Equal(t, 0, len(res.tuples))
+	assert.IsType(t, &ErrUnknownColumn{}, res.err)
 }
 
 func TestLeftJoinProper(t *testing.T) {
@@ -400,7 +599,7 @@ func TestLeftJoinProper(t *testing.T) {
 		columns: []*column{newColumn("", "id"), newColumn("", "name")},
 		tuples:  []*tuple{&tuple{values: []interface{}{0, "zero"}}},
 	}
-	tbl := create("TestLeftJoinProper", []string{"id", "size"})
+	tbl, _ := create("TestLeftJoinProper", []string{"id", "size"})
 	tbl.insert(0, 100)
 	res := r.leftJoin("TestLeftJoinProper", "id")
 	assert.Equal(t, 4, len(res.columns))
@@ -434,7 +633,7 @@ func TestLeftJoinNotFound(t *testing.T) {
 			&tuple{values: []interface{}{0, "zero"}},
 		},
 	}
-	tbl := create("TestLeftJoinNotFound", []string{"id", "size"})
+	tbl, _ := create("TestLeftJoinNotFound", []string{"id", "size"})
 	tbl.insert(1, 100)
 	res := r.leftJoin("TestLeftJoinNotFound", "id")
 	assert.Equal(t, 4, len(res.columns))
@@ -468,7 +667,7 @@ func TestLeftJoinNil(t *testing.T) {
 			&tuple{values: []interface{}{nil, "zero"}},
 		},
 	}
-	tbl := create("TestLeftJoinNotFound", []string{"id", "size"})
+	tbl, _ := create("TestLeftJoinNotFound", []string{"id", "size"})
 	tbl.insert(nil, 100)
 	res := r.leftJoin("TestLeftJoinNotFound", "id")
 	assert.Equal(t, 4, len(res.columns))
@@ -502,7 +701,7 @@ func TestLeftJoinMultiple(t *testing.T) {
 			&tuple{values: []interface{}{0, "zero"}},
 		},
 	}
-	tbl := create("TestLeftJoinMultiple", []string{"id", "size"})
+	tbl, _ := create("TestLeftJoinMultiple", []string{"id", "size"})
 	tbl.insert(0, 100)
 	tbl.insert(0, 200)
 	res := r.leftJoin("TestLeftJoinMultiple", "id")
@@ -532,3 +731,81 @@ func TestLeftJoinMultipleByRelation(t *testing.T) {
 	assert.Equal(t, []interface{}{0, "zero", 0, 100}, res.tuples[0].values)
 	assert.Equal(t, []interface{}{0, "zero", 0, 200}, res.tuples[1].values)
 }
+
+func TestInsertArity(t *testing.T) {
+	tbl, _ := create("TestInsertArity", []string{"id", "name"})
+	assert.Error(t, tbl.insert(0))
+	assert.Error(t, tbl.insert(0, "zero", "extra"))
+	assert.Equal(t, 0, len(from(tbl).tuples))
+}
+
+func TestInsertTyped(t *testing.T) {
+	tbl, _ := createTable("TestInsertTyped", []columnDef{
+		{"id", typeInteger}, {"price", typeReal},
+	})
+	assert.NoError(t, tbl.insert(0, 1.5))
+	assert.NoError(t, tbl.insert(1, 2))
+	assert.NoError(t, tbl.insert(nil, nil))
+	assert.Error(t, tbl.insert("two", 2.0))
+	assert.Equal(t, 3, len(from(tbl).tuples))
+	assert.Equal(t, []interface{}{1, 2.0}, from(tbl).tuples[1].values)
+}
+
+func TestDropRegistered(t *testing.T) {
+	create("TestDropRegistered", []string{"id"})
+	assert.True(t, drop("TestDropRegistered"))
+	assert.Nil(t, tables["TestDropRegistered"])
+}
+
+func TestDropNotRegistered(t *testing.T) {
+	assert.False(t, drop("TestDropNotRegistered"))
+}
+
+func TestUpdateProper(t *testing.T) {
+	tbl, _ := create("TestUpdateProper", []string{"id", "name"})
+	tbl.insert(0, "zero")
+	tbl.insert(1, "one")
+	old := from("TestUpdateProper")
+	n, err := tbl.update(
+		old.equal("id", 0).tuples, map[string]interface{}{"name": "ZERO"},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []interface{}{0, "ZERO"}, from(tbl).tuples[0].values)
+	assert.Equal(t, []interface{}{0, "zero"}, old.tuples[0].values,
+		"it should not affect the relations already taken",
+	)
+}
+
+func TestUpdateUnknown(t *testing.T) {
+	tbl, _ := create("TestUpdateUnknown", []string{"id"})
+	tbl.insert(0)
+	_, err := tbl.update(from(tbl).tuples, map[string]interface{}{"unknown": 1})
+	assert.IsType(t, &ErrUnknownColumn{}, err)
+	assert.Equal(t, []interface{}{0}, from(tbl).tuples[0].values)
+}
+
+func TestUpdateTyped(t *testing.T) {
+	tbl, _ := createTable("TestUpdateTyped", []columnDef{{"id", typeInteger}})
+	tbl.insert(0)
+	_, err := tbl.update(from(tbl).tuples, map[string]interface{}{"id": "zero"})
+	assert.Error(t, err)
+	assert.Equal(t, []interface{}{0}, from(tbl).tuples[0].values)
+}
+
+func TestDeleteProper(t *testing.T) {
+	tbl, _ := create("TestDeleteProper", []string{"id"})
+	tbl.insert(0)
+	tbl.insert(1)
+	old := from("TestDeleteProper")
+	n, err := tbl.delete(old.equal("id", 0).tuples)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, len(from(tbl).tuples))
+	assert.Equal(t, 2, len(old.tuples))
+}
+
+func TestStringError(t *testing.T) {
+	r := from("TestStringError")
+	assert.Equal(t, "error: unknown table \"TestStringError\"\n", r.String())
+}
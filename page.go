@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+)
+
+const pageSize = 4096
+
+// page is a slotted page. the header has the number of the slots
+// and the start of the records, which are placed from the end of the page
+// toward the slot array following the header. each slot has the offset
+// and the length of its record, where the offset 0 marks a deleted one.
+// the slots of the deleted records are never reused, so that the number
+// of a slot never refers to another record than the one stored first in it
+type page []byte
+
+const (
+	pageHeaderSize = 4
+	slotSize       = 4
+)
+
+func newPage() page {
+	p := make(page, pageSize)
+	p.setSlotCount(0)
+	p.setDataStart(pageSize)
+	return p
+}
+
+func (p page) slotCount() int {
+	return int(binary.LittleEndian.Uint16(p[0:]))
+}
+
+func (p page) setSlotCount(n int) {
+	binary.LittleEndian.PutUint16(p[0:], uint16(n))
+}
+
+// dataStart is stored minus one, as pageSize itself does not fit in 16 bits
+func (p page) dataStart() int {
+	return int(binary.LittleEndian.Uint16(p[2:])) + 1
+}
+
+func (p page) setDataStart(n int) {
+	binary.LittleEndian.PutUint16(p[2:], uint16(n-1))
+}
+
+func (p page) slot(i int) (int, int) {
+	s := pageHeaderSize + i*slotSize
+	return int(binary.LittleEndian.Uint16(p[s:])),
+		int(binary.LittleEndian.Uint16(p[s+2:]))
+}
+
+func (p page) setSlot(i, offset, length int) {
+	s := pageHeaderSize + i*slotSize
+	binary.LittleEndian.PutUint16(p[s:], uint16(offset))
+	binary.LittleEndian.PutUint16(p[s+2:], uint16(length))
+}
+
+// get returns the record in the slot, or nil if it is deleted.
+// the record refers to the page, so it must be copied to be kept
+func (p page) get(i int) []byte {
+	if i < 0 || i >= p.slotCount() {
+		return nil
+	}
+	offset, length := p.slot(i)
+	if offset == 0 {
+		return nil
+	}
+	return p[offset : offset+length]
+}
+
+// insert stores the record in a new slot,
+// reporting false if the page does not have enough space for it
+func (p page) insert(rec []byte) (int, bool) {
+	if !p.reserve(len(rec) + slotSize) {
+		return 0, false
+	}
+	i := p.slotCount()
+	p.setSlotCount(i + 1)
+	p.place(i, rec)
+	return i, true
+}
+
+func (p page) delete(i int) {
+	if i >= 0 && i < p.slotCount() {
+		p.setSlot(i, 0, 0)
+	}
+}
+
+// update replaces the record in the slot, keeping the slot number.
+// it reports false and keeps the old record if the new one does not fit
+func (p page) update(i int, rec []byte) bool {
+	old := p.get(i)
+	if old == nil {
+		return false
+	}
+	if len(rec) <= len(old) {
+		offset, _ := p.slot(i)
+		copy(p[offset:], rec)
+		p.setSlot(i, offset, len(rec))
+		return true
+	}
+	saved := append([]byte{}, old...)
+	p.delete(i)
+	if !p.reserve(len(rec)) {
+		// the old record fits in the space it has freed
+		p.reserve(len(saved))
+		p.place(i, saved)
+		return false
+	}
+	p.place(i, rec)
+	return true
+}
+
+func (p page) freeSpace() int {
+	return p.dataStart() - pageHeaderSize - p.slotCount()*slotSize
+}
+
+// reserve makes n bytes of contiguous free space, compacting the records
+// if the space is fragmented by deletions
+func (p page) reserve(n int) bool {
+	if p.freeSpace() >= n {
+		return true
+	}
+	p.compact()
+	return p.freeSpace() >= n
+}
+
+func (p page) place(i int, rec []byte) {
+	offset := p.dataStart() - len(rec)
+	copy(p[offset:], rec)
+	p.setDataStart(offset)
+	p.setSlot(i, offset, len(rec))
+}
+
+// compact moves the records to the end of the page,
+// leaving the free space in one piece
+func (p page) compact() {
+	n := p.slotCount()
+	recs := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		if rec := p.get(i); rec != nil {
+			recs[i] = append([]byte{}, rec...)
+		}
+	}
+	p.setDataStart(pageSize)
+	for i, rec := range recs {
+		if rec != nil {
+			p.place(i, rec)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPageInsertGet(t *testing.T) {
+	p := newPage()
+	i, ok := p.insert([]byte("apple"))
+	assert.True(t, ok)
+	j, ok := p.insert([]byte("orange"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("apple"), p.get(i))
+	assert.Equal(t, []byte("orange"), p.get(j))
+	assert.Nil(t, p.get(2))
+}
+
+func TestPageFull(t *testing.T) {
+	p := newPage()
+	rec := bytes.Repeat([]byte{1}, 100)
+	n := 0
+	for {
+		if _, ok := p.insert(rec); !ok {
+			break
+		}
+		n++
+	}
+	assert.Equal(t, (pageSize-pageHeaderSize)/(100+slotSize), n)
+	_, ok := newPage().insert(make([]byte, maxRowSize+1))
+	assert.False(t, ok)
+}
+
+func TestPageLargest(t *testing.T) {
+	p := newPage()
+	rec := bytes.Repeat([]byte{1}, maxRowSize)
+	i, ok := p.insert(rec)
+	assert.True(t, ok)
+	assert.Equal(t, rec, p.get(i))
+}
+
+func TestPageDeleteCompact(t *testing.T) {
+	p := newPage()
+	rec := bytes.Repeat([]byte{1}, 1000)
+	for i := 0; i < 4; i++ {
+		p.insert(rec)
+	}
+	_, ok := p.insert(rec)
+	assert.False(t, ok)
+	p.delete(1)
+	assert.Nil(t, p.get(1))
+	i, ok := p.insert(bytes.Repeat([]byte{2}, 1000))
+	assert.True(t, ok, "it should compact the page")
+	assert.Equal(t, 4, i, "the deleted slot should not be reused")
+	assert.Nil(t, p.get(1))
+	assert.Equal(t, rec, p.get(0))
+	assert.Equal(t, byte(2), p.get(4)[0])
+	assert.Equal(t, rec, p.get(3))
+}
+
+func TestPageUpdate(t *testing.T) {
+	p := newPage()
+	p.insert([]byte("apple"))
+	i, _ := p.insert([]byte("orange"))
+	p.insert([]byte("cabbage"))
+	assert.True(t, p.update(i, []byte("fig")))
+	assert.Equal(t, []byte("fig"), p.get(i))
+	assert.True(t, p.update(i, []byte("watermelon")))
+	assert.Equal(t, []byte("watermelon"), p.get(i))
+	assert.Equal(t, []byte("apple"), p.get(0))
+	assert.Equal(t, []byte("cabbage"), p.get(2))
+}
+
+func TestPageUpdateTooLarge(t *testing.T) {
+	p := newPage()
+	p.insert(bytes.Repeat([]byte{1}, 2000))
+	i, _ := p.insert([]byte("apple"))
+	assert.False(t, p.update(i, bytes.Repeat([]byte{2}, 2100)))
+	assert.Equal(t, []byte("apple"), p.get(i))
+}
@@ -0,0 +1,1182 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type statement interface {
+	statement()
+}
+
+type selectStmt struct {
+	columns []string // nil selects all the columns
+	aggs    []*aggCall
+	from    *tableRef
+	joins   []*joinClause
+	where   expr
+	groupBy []string
+	having  expr
+	orderBy []sortKey
+	limit   *int // nil means no limit
+	offset  int
+}
+
+func (*selectStmt) statement() {}
+
+// a table reference is either a table name or a subquery
+type tableRef struct {
+	name string
+	sub  *selectStmt
+}
+
+// aggregate function calls in the select list, e.g. AVG(price),
+// refer to the columns named as their aggregators, e.g. avg(price)
+type aggCall struct {
+	fn  string
+	arg string
+}
+
+func (a *aggCall) name() string {
+	return strings.ToLower(a.fn) + "(" + a.arg + ")"
+}
+
+// addAgg registers the aggregate call unless the same one is already there
+func (s *selectStmt) addAgg(agg *aggCall) {
+	for _, a := range s.aggs {
+		if a.name() == agg.name() {
+			return
+		}
+	}
+	s.aggs = append(s.aggs, agg)
+}
+
+// USING (a) is the same as ON a = a, and a cross join has no keys
+type joinClause struct {
+	kind  joinKind
+	right *tableRef
+	keys  []joinKey
+}
+
+type createStmt struct {
+	name        string
+	columns     []columnDef
+	constraints []constraintDef
+}
+
+func (*createStmt) statement() {}
+
+type createIndexStmt struct {
+	name   string
+	table  string
+	column string
+	kind   indexKind
+}
+
+func (*createIndexStmt) statement() {}
+
+type insertStmt struct {
+	table   string
+	columns []string // nil means all the columns in order
+	rows    [][]interface{}
+}
+
+func (*insertStmt) statement() {}
+
+type updateStmt struct {
+	table string
+	set   map[string]interface{}
+	where expr
+}
+
+func (*updateStmt) statement() {}
+
+type deleteStmt struct {
+	table string
+	where expr
+}
+
+func (*deleteStmt) statement() {}
+
+type dropStmt struct {
+	name string
+}
+
+func (*dropStmt) statement() {}
+
+type beginStmt struct{}
+
+func (*beginStmt) statement() {}
+
+type commitStmt struct{}
+
+func (*commitStmt) statement() {}
+
+// rollbackStmt rolls back to the savepoint, or the whole transaction if none
+type rollbackStmt struct {
+	savepoint string
+}
+
+func (*rollbackStmt) statement() {}
+
+type savepointStmt struct {
+	name string
+}
+
+func (*savepointStmt) statement() {}
+
+type releaseStmt struct {
+	name string
+}
+
+func (*releaseStmt) statement() {}
+
+var reserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true,
+	"HAVING": true, "ORDER": true, "BY": true, "LIMIT": true, "OFFSET": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"OUTER": true, "CROSS": true, "USING": true, "ON": true,
+	"AND": true, "OR": true, "NOT": true, "IS": true, "IN": true,
+	"BETWEEN": true, "LIKE": true, "NULL": true, "TRUE": true, "FALSE": true,
+	"CREATE": true, "TABLE": true, "INDEX": true, "DROP": true,
+	"INSERT": true, "INTO": true, "VALUES": true, "UPDATE": true, "SET": true,
+	"DELETE": true, "PRIMARY": true, "KEY": true, "UNIQUE": true,
+	"FOREIGN": true, "REFERENCES": true, "CASCADE": true, "RESTRICT": true,
+	"DEFAULT": true, "CHECK": true, "CURRENT_TIMESTAMP": true,
+	"AUTO_INCREMENT": true, "IDENTITY": true,
+	"BEGIN": true, "COMMIT": true, "ROLLBACK": true, "SAVEPOINT": true,
+	"RELEASE": true, "TRANSACTION": true,
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	aggs []*aggCall // aggregate calls found in expressions
+}
+
+func parse(src string) (statement, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	p.accept(";")
+	if p.peek().kind != tokEOF {
+		return nil, p.unexpected("end of input")
+	}
+	return stmt, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(text string) bool {
+	if p.peek().is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected(text)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(expected string) error {
+	t := p.peek()
+	return fmt.Errorf(
+		"syntax error at %d: expected %s, found %s", t.pos, expected, t,
+	)
+}
+
+func (p *parser) parseStatement() (statement, error) {
+	t := p.peek()
+	switch {
+	case t.is("SELECT"):
+		return p.parseSelect()
+	case t.is("CREATE"):
+		return p.parseCreate()
+	case t.is("INSERT"):
+		return p.parseInsert()
+	case t.is("UPDATE"):
+		return p.parseUpdate()
+	case t.is("DELETE"):
+		return p.parseDelete()
+	case t.is("DROP"):
+		return p.parseDrop()
+	case t.is("BEGIN"), t.is("COMMIT"), t.is("ROLLBACK"),
+		t.is("SAVEPOINT"), t.is("RELEASE"):
+		return p.parseTransaction()
+	}
+	return nil, p.unexpected("statement")
+}
+
+func (p *parser) parseIdent() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent || reserved[strings.ToUpper(t.text)] {
+		return "", p.unexpected("identifier")
+	}
+	p.next()
+	return t.text, nil
+}
+
+func (p *parser) parseIdentList() ([]string, error) {
+	names := []string{}
+	for {
+		name, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.accept(",") {
+			return names, nil
+		}
+	}
+}
+
+// parseColumnName parses a column name,
+// which may be qualified by the table name as in items.price
+func (p *parser) parseColumnName() (string, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return "", err
+	}
+	if !p.accept(".") {
+		return name, nil
+	}
+	col, err := p.parseIdent()
+	if err != nil {
+		return "", err
+	}
+	return name + "." + col, nil
+}
+
+func (p *parser) parseColumnList() ([]string, error) {
+	names := []string{}
+	for {
+		name, err := p.parseColumnName()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.accept(",") {
+			return names, nil
+		}
+	}
+}
+
+func (p *parser) parseSelect() (*selectStmt, error) {
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+	s := &selectStmt{}
+	if !p.accept("*") {
+		s.columns = []string{}
+		for {
+			col, agg, err := p.parseSelectItem()
+			if err != nil {
+				return nil, err
+			}
+			s.columns = append(s.columns, col)
+			if agg != nil {
+				s.addAgg(agg)
+			}
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	from, err := p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+	s.from = from
+	for p.atJoin() {
+		j, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		s.joins = append(s.joins, j)
+	}
+	p.aggs = nil
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.aggs) > 0 {
+		return nil, fmt.Errorf("aggregate functions are not allowed in WHERE")
+	}
+	s.where = where
+	if p.accept("GROUP") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		cols, err := p.parseColumnList()
+		if err != nil {
+			return nil, err
+		}
+		s.groupBy = cols
+	}
+	if p.accept("HAVING") {
+		having, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		for _, agg := range p.aggs {
+			s.addAgg(agg)
+		}
+		s.having = having
+	}
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			sk, err := p.parseSortKey()
+			if err != nil {
+				return nil, err
+			}
+			s.orderBy = append(s.orderBy, sk)
+			if !p.accept(",") {
+				break
+			}
+		}
+		for _, agg := range p.aggs {
+			s.addAgg(agg)
+		}
+	}
+	if p.accept("LIMIT") {
+		n, err := p.parseCount()
+		if err != nil {
+			return nil, err
+		}
+		s.limit = &n
+		if p.accept("OFFSET") {
+			if s.offset, err = p.parseCount(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// parseCount parses a non-negative integer such as the number of rows
+func (p *parser) parseCount() (int, error) {
+	t := p.peek()
+	if t.kind != tokNumber || strings.Contains(t.text, ".") {
+		return 0, p.unexpected("integer")
+	}
+	p.next()
+	return strconv.Atoi(t.text)
+}
+
+// parseSortKey parses a sort key, whose aggregate call, if any,
+// is collected as those in expressions
+func (p *parser) parseSortKey() (sortKey, error) {
+	col, agg, err := p.parseSelectItem()
+	if err != nil {
+		return sortKey{}, err
+	}
+	if agg != nil {
+		p.aggs = append(p.aggs, agg)
+	}
+	sk := sortKey{column: col}
+	if !p.accept("ASC") {
+		sk.desc = p.accept("DESC")
+	}
+	if p.accept("NULLS") {
+		switch {
+		case p.accept("FIRST"):
+			sk.nullsFirst = true
+		case p.accept("LAST"):
+		default:
+			return sortKey{}, p.unexpected("FIRST or LAST")
+		}
+	}
+	return sk, nil
+}
+
+// parseSelectItem parses either a column name or an aggregate call,
+// returning the name of the column it refers to
+func (p *parser) parseSelectItem() (string, *aggCall, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return "", nil, err
+	}
+	if p.accept(".") {
+		col, err := p.parseIdent()
+		if err != nil {
+			return "", nil, err
+		}
+		return name + "." + col, nil, nil
+	}
+	if !p.accept("(") {
+		return name, nil, nil
+	}
+	agg := &aggCall{fn: strings.ToUpper(name)}
+	if p.accept("*") {
+		agg.arg = "*"
+	} else if agg.arg, err = p.parseColumnName(); err != nil {
+		return "", nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return "", nil, err
+	}
+	return agg.name(), agg, nil
+}
+
+func (p *parser) parseTableRef() (*tableRef, error) {
+	if p.accept("(") {
+		sub, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &tableRef{sub: sub}, nil
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	return &tableRef{name: name}, nil
+}
+
+func (p *parser) atJoin() bool {
+	for _, kw := range []string{"JOIN", "INNER", "LEFT", "RIGHT", "FULL", "CROSS"} {
+		if p.peek().is(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseJoin() (*joinClause, error) {
+	j := &joinClause{kind: innerJoinKind}
+	switch {
+	case p.accept("INNER"):
+	case p.accept("LEFT"):
+		j.kind = leftJoinKind
+		p.accept("OUTER")
+	case p.accept("RIGHT"):
+		j.kind = rightJoinKind
+		p.accept("OUTER")
+	case p.accept("FULL"):
+		j.kind = fullJoinKind
+		p.accept("OUTER")
+	case p.accept("CROSS"):
+		j.kind = crossJoinKind
+	}
+	if err := p.expect("JOIN"); err != nil {
+		return nil, err
+	}
+	right, err := p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+	j.right = right
+	if j.kind == crossJoinKind {
+		return j, nil
+	}
+	if p.accept("ON") {
+		if j.keys, err = p.parseJoinKeys(); err != nil {
+			return nil, err
+		}
+		return j, nil
+	}
+	if err := p.expect("USING"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	cols, err := p.parseIdentList()
+	if err != nil {
+		return nil, err
+	}
+	for _, cn := range cols {
+		j.keys = append(j.keys, on(cn, cn))
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// parseJoinKeys parses the equalities of columns joined by AND,
+// which is the only form of ON supported
+func (p *parser) parseJoinKeys() ([]joinKey, error) {
+	keys := []joinKey{}
+	for {
+		left, err := p.parseColumnName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		right, err := p.parseColumnName()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, on(left, right))
+		if !p.accept("AND") {
+			return keys, nil
+		}
+	}
+}
+
+func (p *parser) parseWhere() (expr, error) {
+	if !p.accept("WHERE") {
+		return nil, nil
+	}
+	return p.parseExpr()
+}
+
+// parseExpr parses an expression, whose operators are
+// OR, AND, NOT and then the predicates in order of precedence
+func (p *parser) parseExpr() (expr, error) {
+	e, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek().is("OR") {
+		return e, nil
+	}
+	es := []expr{e}
+	for p.accept("OR") {
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return or(es...), nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	e, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek().is("AND") {
+		return e, nil
+	}
+	es := []expr{e}
+	for p.accept("AND") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return and(es...), nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("NOT") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return not(e), nil
+	}
+	return p.parsePredicate()
+}
+
+var comparisonOps = []string{"=", "<>", "!=", "<", "<=", ">", ">="}
+
+func (p *parser) parsePredicate() (expr, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range comparisonOps {
+		if p.accept(op) {
+			r, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			if op == "!=" {
+				op = "<>"
+			}
+			return &comparison{op: op, left: e, right: r}, nil
+		}
+	}
+	if p.accept("IS") {
+		negated := p.accept("NOT")
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{operand: e, negated: negated}, nil
+	}
+	negated := p.accept("NOT")
+	switch {
+	case p.accept("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		list := []expr{}
+		for {
+			item, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &inExpr{operand: e, list: list, negated: negated}, nil
+	case p.accept("BETWEEN"):
+		low, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenExpr{
+			operand: e, low: low, high: high, negated: negated,
+		}, nil
+	case p.accept("LIKE"):
+		pat, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &likeExpr{operand: e, pattern: pat, negated: negated}, nil
+	case negated:
+		return nil, p.unexpected("IN, BETWEEN or LIKE")
+	}
+	return e, nil
+}
+
+// parsePrimary parses a literal, a column, an aggregate call,
+// CURRENT_TIMESTAMP, NEXTVAL(name) or a parenthesized expression
+func (p *parser) parsePrimary() (expr, error) {
+	if p.accept("CURRENT_TIMESTAMP") {
+		return call("CURRENT_TIMESTAMP"), nil
+	}
+	if p.peek().is("NEXTVAL") && p.toks[p.pos+1].is("(") {
+		p.next()
+		p.next()
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return call("NEXTVAL", arg), nil
+	}
+	if p.accept("(") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	if t := p.peek(); t.kind == tokIdent && !reserved[strings.ToUpper(t.text)] {
+		name, agg, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		if agg != nil {
+			p.aggs = append(p.aggs, agg)
+		}
+		return ref(name), nil
+	}
+	v, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	return lit(v), nil
+}
+
+func (p *parser) parseLiteral() (interface{}, error) {
+	neg := p.accept("-")
+	t := p.peek()
+	switch {
+	case t.kind == tokNumber:
+		p.next()
+		if strings.Contains(t.text, ".") {
+			f, err := strconv.ParseFloat(t.text, 64)
+			if err != nil {
+				return nil, err
+			}
+			if neg {
+				f = -f
+			}
+			return f, nil
+		}
+		n, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, err
+		}
+		if neg {
+			n = -n
+		}
+		return n, nil
+	case neg:
+		return nil, p.unexpected("number")
+	case t.kind == tokString:
+		p.next()
+		return t.text, nil
+	case t.kind == tokBlob:
+		p.next()
+		return []byte(t.text), nil
+	case t.is("NULL"):
+		p.next()
+		return nil, nil
+	case t.is("TRUE"):
+		p.next()
+		return true, nil
+	case t.is("FALSE"):
+		p.next()
+		return false, nil
+	}
+	return nil, p.unexpected("literal")
+}
+
+func (p *parser) parseLiteralList() ([]interface{}, error) {
+	vals := []interface{}{}
+	for {
+		v, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+		if !p.accept(",") {
+			return vals, nil
+		}
+	}
+}
+
+func (p *parser) parseCreate() (statement, error) {
+	if err := p.expect("CREATE"); err != nil {
+		return nil, err
+	}
+	if p.accept("INDEX") {
+		return p.parseCreateIndex()
+	}
+	if err := p.expect("TABLE"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	s := &createStmt{name: name}
+	for {
+		if t := p.peek(); t.is("PRIMARY") || t.is("UNIQUE") ||
+			t.is("FOREIGN") || t.is("CHECK") {
+			c, err := p.parseConstraint()
+			if err != nil {
+				return nil, err
+			}
+			s.constraints = append(s.constraints, c)
+		} else {
+			d, err := p.parseColumnDef()
+			if err != nil {
+				return nil, err
+			}
+			s.columns = append(s.columns, d)
+			for {
+				c, err := p.parseColumnConstraint(d.name)
+				if err != nil {
+					return nil, err
+				}
+				if c == nil {
+					break
+				}
+				s.constraints = append(s.constraints, c)
+			}
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseConstraint parses a table constraint, PRIMARY KEY (columns),
+// UNIQUE (columns), FOREIGN KEY (columns) REFERENCES ... or CHECK (expr)
+func (p *parser) parseConstraint() (constraintDef, error) {
+	if p.peek().is("CHECK") {
+		return p.parseCheck("")
+	}
+	k, foreign := keyDef{}, false
+	switch {
+	case p.accept("PRIMARY"):
+		k.primary = true
+	case p.accept("FOREIGN"):
+		foreign = true
+	default:
+		if err := p.expect("UNIQUE"); err != nil {
+			return nil, err
+		}
+	}
+	if k.primary || foreign {
+		if err := p.expect("KEY"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	cols, err := p.parseIdentList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if foreign {
+		return p.parseReferences(cols)
+	}
+	k.columns = cols
+	return k, nil
+}
+
+// parseColumnConstraint parses one of the constraints following
+// a column definition, PRIMARY KEY, UNIQUE, REFERENCES ..., NOT NULL,
+// DEFAULT expr, CHECK (expr) or AUTO_INCREMENT, which is also written
+// as IDENTITY, returning nil if there is none of them
+func (p *parser) parseColumnConstraint(colName string) (constraintDef, error) {
+	switch {
+	case p.accept("UNIQUE"):
+		return unique(colName), nil
+	case p.accept("PRIMARY"):
+		if err := p.expect("KEY"); err != nil {
+			return nil, err
+		}
+		return primaryKey(colName), nil
+	case p.peek().is("REFERENCES"):
+		return p.parseReferences([]string{colName})
+	case p.accept("NOT"):
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return notNull(colName), nil
+	case p.accept("DEFAULT"):
+		e, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return defaultTo(colName, e), nil
+	case p.peek().is("CHECK"):
+		return p.parseCheck(colName)
+	case p.accept("AUTO_INCREMENT") || p.accept("IDENTITY"):
+		return autoIncrement(colName), nil
+	}
+	return nil, nil
+}
+
+// parseCheck parses CHECK (expr) of the column, or of the table if none
+func (p *parser) parseCheck(colName string) (constraintDef, error) {
+	if err := p.expect("CHECK"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return checkDef{column: colName, cond: e}, nil
+}
+
+// parseReferences parses REFERENCES table, optionally followed by
+// the referenced columns and ON DELETE with the action
+func (p *parser) parseReferences(cols []string) (constraintDef, error) {
+	if err := p.expect("REFERENCES"); err != nil {
+		return nil, err
+	}
+	tbl, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	fk := references(cols, tbl)
+	if p.accept("(") {
+		if fk.refColumns, err = p.parseIdentList(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if !p.accept("ON") {
+		return fk, nil
+	}
+	if err := p.expect("DELETE"); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.accept("RESTRICT"):
+		fk.onDelete = restrictAction
+	case p.accept("CASCADE"):
+		fk.onDelete = cascadeAction
+	case p.accept("SET"):
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		fk.onDelete = setNullAction
+	case p.accept("NO"):
+		// NO ACTION is checked as soon as RESTRICT, without deferring
+		if err := p.expect("ACTION"); err != nil {
+			return nil, err
+		}
+		fk.onDelete = restrictAction
+	default:
+		return nil, p.unexpected("RESTRICT, CASCADE, SET NULL or NO ACTION")
+	}
+	return fk, nil
+}
+
+// parseCreateIndex parses the rest of CREATE INDEX name ON table (column),
+// optionally followed by USING BTREE or USING HASH
+func (p *parser) parseCreateIndex() (*createIndexStmt, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("ON"); err != nil {
+		return nil, err
+	}
+	tbl, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	col, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	s := &createIndexStmt{name: name, table: tbl, column: col}
+	if p.accept("USING") {
+		t := p.peek()
+		if t.kind != tokIdent {
+			return nil, p.unexpected("index type")
+		}
+		kind, err := parseIndexKind(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("syntax error at %d: %v", t.pos, err)
+		}
+		p.next()
+		s.kind = kind
+	}
+	return s, nil
+}
+
+// parseColumnDef parses a column name optionally followed by its type
+func (p *parser) parseColumnDef() (columnDef, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return columnDef{}, err
+	}
+	d := columnDef{name: name}
+	if t := p.peek(); t.kind == tokIdent && !reserved[strings.ToUpper(t.text)] {
+		typ, err := parseColType(t.text)
+		if err != nil {
+			return columnDef{}, fmt.Errorf("syntax error at %d: %v", t.pos, err)
+		}
+		p.next()
+		d.typ = typ
+	}
+	return d, nil
+}
+
+func (p *parser) parseInsert() (*insertStmt, error) {
+	if err := p.expect("INSERT"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("INTO"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	s := &insertStmt{table: name}
+	if p.accept("(") {
+		cols, err := p.parseIdentList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		s.columns = cols
+	}
+	if err := p.expect("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		vals, err := p.parseLiteralList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		s.rows = append(s.rows, vals)
+		if !p.accept(",") {
+			return s, nil
+		}
+	}
+}
+
+func (p *parser) parseUpdate() (*updateStmt, error) {
+	if err := p.expect("UPDATE"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("SET"); err != nil {
+		return nil, err
+	}
+	s := &updateStmt{table: name, set: map[string]interface{}{}}
+	for {
+		col, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		val, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		s.set[col] = val
+		if !p.accept(",") {
+			break
+		}
+	}
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+	s.where = where
+	return s, nil
+}
+
+func (p *parser) parseDelete() (*deleteStmt, error) {
+	if err := p.expect("DELETE"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+	return &deleteStmt{table: name, where: where}, nil
+}
+
+func (p *parser) parseDrop() (*dropStmt, error) {
+	if err := p.expect("DROP"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("TABLE"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	return &dropStmt{name: name}, nil
+}
+
+// parseTransaction parses BEGIN, COMMIT or ROLLBACK, each optionally
+// followed by TRANSACTION, ROLLBACK TO [SAVEPOINT] name,
+// SAVEPOINT name or RELEASE [SAVEPOINT] name
+func (p *parser) parseTransaction() (statement, error) {
+	switch t := p.next(); {
+	case t.is("BEGIN"):
+		p.accept("TRANSACTION")
+		return &beginStmt{}, nil
+	case t.is("COMMIT"):
+		p.accept("TRANSACTION")
+		return &commitStmt{}, nil
+	case t.is("ROLLBACK"):
+		p.accept("TRANSACTION")
+		if !p.accept("TO") {
+			return &rollbackStmt{}, nil
+		}
+		p.accept("SAVEPOINT")
+		name, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &rollbackStmt{savepoint: name}, nil
+	case t.is("SAVEPOINT"):
+		name, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &savepointStmt{name: name}, nil
+	}
+	p.accept("SAVEPOINT")
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	return &releaseStmt{name: name}, nil
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseSelectAll(t *testing.T) {
+	stmt, err := parse("SELECT * FROM items")
+	assert.NoError(t, err)
+	assert.Equal(t, &selectStmt{from: &tableRef{name: "items"}}, stmt)
+}
+
+func TestParseSelectColumns(t *testing.T) {
+	stmt, err := parse("select item_name, price from items;")
+	assert.NoError(t, err)
+	assert.Equal(t, &selectStmt{
+		columns: []string{"item_name", "price"},
+		from:    &tableRef{name: "items"},
+	}, stmt)
+}
+
+func TestParseSelectFull(t *testing.T) {
+	stmt, err := parse(
+		"SELECT * FROM items LEFT JOIN types USING (type_id) " +
+			"WHERE price < 250 AND item_name = 'apple' ORDER BY price",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, &selectStmt{
+		from: &tableRef{name: "items"},
+		joins: []*joinClause{
+			{
+				kind:  leftJoinKind,
+				right: &tableRef{name: "types"},
+				keys:  []joinKey{{"type_id", "type_id"}},
+			},
+		},
+		where: and(
+			lt(ref("price"), lit(250)),
+			eq(ref("item_name"), lit("apple")),
+		),
+		orderBy: []sortKey{{column: "price"}},
+	}, stmt)
+}
+
+func TestParseSubquery(t *testing.T) {
+	stmt, err := parse("SELECT * FROM (SELECT * FROM items WHERE price < 250)")
+	assert.NoError(t, err)
+	assert.Equal(t, &selectStmt{
+		from: &tableRef{sub: &selectStmt{
+			from:  &tableRef{name: "items"},
+			where: lt(ref("price"), lit(250)),
+		}},
+	}, stmt)
+}
+
+func TestParseLiterals(t *testing.T) {
+	cases := []struct {
+		in  string
+		out interface{}
+	}{
+		{"1", 1}, {"-1", -1}, {"1.5", 1.5}, {"-1.5", -1.5},
+		{"'one'", "one"}, {"NULL", nil}, {"TRUE", true}, {"false", false},
+		{"X'CAFE'", []byte{0xca, 0xfe}},
+	}
+	for _, c := range cases {
+		stmt, err := parse("SELECT * FROM t WHERE x = " + c.in)
+		if assert.NoError(t, err, c.in) {
+			assert.Equal(t,
+				eq(ref("x"), lit(c.out)), stmt.(*selectStmt).where, c.in,
+			)
+		}
+	}
+}
+
+func TestParseTrailingGarbage(t *testing.T) {
+	_, err := parse("SELECT * FROM items items")
+	assert.Error(t, err)
+}
+
+func TestParseReservedAsIdent(t *testing.T) {
+	_, err := parse("SELECT from FROM items")
+	assert.Error(t, err)
+}
+
+func TestParseUnknownStatement(t *testing.T) {
+	_, err := parse("EXPLAIN SELECT * FROM items")
+	assert.Error(t, err)
+}
+
+func TestParseNotWithoutPredicate(t *testing.T) {
+	_, err := parse("SELECT * FROM items WHERE price NOT 100")
+	assert.Error(t, err)
+}
+
+func TestParseAggregateInWhere(t *testing.T) {
+	_, err := parse("SELECT * FROM items WHERE COUNT(*) > 1")
+	assert.Error(t, err)
+}
+
+func TestParseComparisons(t *testing.T) {
+	cases := []struct {
+		in  string
+		out expr
+	}{
+		{"a = 1", eq(ref("a"), lit(1))},
+		{"a <> 1", ne(ref("a"), lit(1))},
+		{"a != 1", ne(ref("a"), lit(1))},
+		{"a < b", lt(ref("a"), ref("b"))},
+		{"a <= 1", le(ref("a"), lit(1))},
+		{"1 > a", gt(lit(1), ref("a"))},
+		{"a >= 1.5", ge(ref("a"), lit(1.5))},
+	}
+	for _, c := range cases {
+		stmt, err := parse("SELECT * FROM t WHERE " + c.in)
+		if assert.NoError(t, err, c.in) {
+			assert.Equal(t, c.out, stmt.(*selectStmt).where, c.in)
+		}
+	}
+}
+
+func TestParsePredicates(t *testing.T) {
+	cases := []struct {
+		in  string
+		out expr
+	}{
+		{"a IS NULL", isNull(ref("a"))},
+		{"a IS NOT NULL", isNotNull(ref("a"))},
+		{"a IN (1, 'one')", in(ref("a"), lit(1), lit("one"))},
+		{"a NOT IN (1)", &inExpr{ref("a"), []expr{lit(1)}, true}},
+		{"a BETWEEN 1 AND b", between(ref("a"), lit(1), ref("b"))},
+		{"a NOT BETWEEN 1 AND 2",
+			&betweenExpr{ref("a"), lit(1), lit(2), true}},
+		{"a LIKE 'ap%'", like(ref("a"), lit("ap%"))},
+		{"a NOT LIKE 'ap%'", &likeExpr{ref("a"), lit("ap%"), true}},
+	}
+	for _, c := range cases {
+		stmt, err := parse("SELECT * FROM t WHERE " + c.in)
+		if assert.NoError(t, err, c.in) {
+			assert.Equal(t, c.out, stmt.(*selectStmt).where, c.in)
+		}
+	}
+}
+
+func TestParseLogicalPrecedence(t *testing.T) {
+	stmt, err := parse(
+		"SELECT * FROM t WHERE a = 1 OR NOT b = 2 AND c = 3 OR (d = 4 OR e = 5)",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, or(
+		eq(ref("a"), lit(1)),
+		and(not(eq(ref("b"), lit(2))), eq(ref("c"), lit(3))),
+		or(eq(ref("d"), lit(4)), eq(ref("e"), lit(5))),
+	), stmt.(*selectStmt).where)
+}
+
+func TestParseCreate(t *testing.T) {
+	stmt, err := parse("CREATE TABLE types (type_id, type_name)")
+	assert.NoError(t, err)
+	assert.Equal(t, &createStmt{
+		name: "types",
+		columns: []columnDef{
+			{"type_id", typeAny}, {"type_name", typeAny},
+		},
+	}, stmt)
+}
+
+func TestParseCreateTyped(t *testing.T) {
+	stmt, err := parse("CREATE TABLE types (type_id INTEGER, type_name text)")
+	assert.NoError(t, err)
+	assert.Equal(t, &createStmt{
+		name: "types",
+		columns: []columnDef{
+			{"type_id", typeInteger}, {"type_name", typeText},
+		},
+	}, stmt)
+}
+
+func TestParseCreateKeys(t *testing.T) {
+	stmt, err := parse("CREATE TABLE items " +
+		"(id INTEGER PRIMARY KEY, name UNIQUE, a, b, UNIQUE (a, b))")
+	assert.NoError(t, err)
+	assert.Equal(t, []constraintDef{
+		primaryKey("id"), unique("name"), unique("a", "b"),
+	}, stmt.(*createStmt).constraints)
+	_, err = parse("CREATE TABLE items (id PRIMARY)")
+	assert.Error(t, err)
+}
+
+func TestParseCreateForeignKeys(t *testing.T) {
+	stmt, err := parse("CREATE TABLE items (id, type_id REFERENCES types, " +
+		"a, b, FOREIGN KEY (a, b) REFERENCES pairs (x, y) ON DELETE CASCADE, " +
+		"parent REFERENCES items (id) ON DELETE SET NULL)")
+	assert.NoError(t, err)
+	assert.Equal(t, []constraintDef{
+		references([]string{"type_id"}, "types"),
+		references([]string{"a", "b"}, "pairs", "x", "y").
+			onDeleteDo(cascadeAction),
+		references([]string{"parent"}, "items", "id").
+			onDeleteDo(setNullAction),
+	}, stmt.(*createStmt).constraints)
+	_, err = parse("CREATE TABLE items (type_id REFERENCES types ON DELETE)")
+	assert.Error(t, err)
+}
+
+func TestParseCreateUnknownType(t *testing.T) {
+	_, err := parse("CREATE TABLE types (type_id DECIMAL)")
+	assert.Error(t, err)
+}
+
+func TestParseCreateIndex(t *testing.T) {
+	stmt, err := parse("CREATE INDEX items_price ON items (price)")
+	assert.NoError(t, err)
+	assert.Equal(t, &createIndexStmt{
+		name: "items_price", table: "items", column: "price",
+	}, stmt)
+}
+
+func TestParseCreateIndexUsing(t *testing.T) {
+	stmt, err := parse("CREATE INDEX items_id ON items (item_id) USING hash")
+	assert.NoError(t, err)
+	assert.Equal(t, &createIndexStmt{
+		name: "items_id", table: "items", column: "item_id", kind: hashIndex,
+	}, stmt)
+	_, err = parse("CREATE INDEX items_id ON items (item_id) USING bitmap")
+	assert.Error(t, err)
+}
+
+func TestParseInsert(t *testing.T) {
+	stmt, err := parse("INSERT INTO types VALUES (1, 'fruit'), (2, NULL)")
+	assert.NoError(t, err)
+	assert.Equal(t, &insertStmt{
+		table: "types",
+		rows:  [][]interface{}{{1, "fruit"}, {2, nil}},
+	}, stmt)
+}
+
+func TestParseInsertColumns(t *testing.T) {
+	stmt, err := parse("INSERT INTO types (type_name) VALUES ('fruit')")
+	assert.NoError(t, err)
+	assert.Equal(t, &insertStmt{
+		table:   "types",
+		columns: []string{"type_name"},
+		rows:    [][]interface{}{{"fruit"}},
+	}, stmt)
+}
+
+func TestParseUpdate(t *testing.T) {
+	stmt, err := parse(
+		"UPDATE items SET price = 100, item_name = 'lemon' WHERE item_id = 1",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, &updateStmt{
+		table: "items",
+		set:   map[string]interface{}{"price": 100, "item_name": "lemon"},
+		where: eq(ref("item_id"), lit(1)),
+	}, stmt)
+}
+
+func TestParseDelete(t *testing.T) {
+	stmt, err := parse("DELETE FROM items WHERE price < 200")
+	assert.NoError(t, err)
+	assert.Equal(t, &deleteStmt{
+		table: "items",
+		where: lt(ref("price"), lit(200)),
+	}, stmt)
+}
+
+func TestParseDeleteAll(t *testing.T) {
+	stmt, err := parse("DELETE FROM items")
+	assert.NoError(t, err)
+	assert.Equal(t, &deleteStmt{table: "items"}, stmt)
+}
+
+func TestParseDrop(t *testing.T) {
+	stmt, err := parse("DROP TABLE items")
+	assert.NoError(t, err)
+	assert.Equal(t, &dropStmt{name: "items"}, stmt)
+}
+
+func TestParseGroupBy(t *testing.T) {
+	stmt, err := parse(
+		"SELECT type_id, avg(price), COUNT(*) FROM items " +
+			"GROUP BY type_id ORDER BY AVG(price)",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, &selectStmt{
+		columns: []string{"type_id", "avg(price)", "count(*)"},
+		aggs: []*aggCall{
+			{fn: "AVG", arg: "price"}, {fn: "COUNT", arg: "*"},
+		},
+		from:    &tableRef{name: "items"},
+		groupBy: []string{"type_id"},
+		orderBy: []sortKey{{column: "avg(price)"}},
+	}, stmt)
+}
+
+func TestParseOrderByAggregate(t *testing.T) {
+	stmt, err := parse("SELECT type_id FROM items GROUP BY type_id " +
+		"ORDER BY COUNT(*)")
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]*aggCall{{fn: "COUNT", arg: "*"}}, stmt.(*selectStmt).aggs,
+	)
+}
+
+func TestParseGroupByHaving(t *testing.T) {
+	stmt, err := parse(
+		"SELECT type_id, supplier_id FROM items " +
+			"GROUP BY type_id, supplier_id " +
+			"HAVING COUNT(*) < 3 AND type_id = 1",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, &selectStmt{
+		columns: []string{"type_id", "supplier_id"},
+		aggs:    []*aggCall{{fn: "COUNT", arg: "*"}},
+		from:    &tableRef{name: "items"},
+		groupBy: []string{"type_id", "supplier_id"},
+		having: and(
+			lt(ref("count(*)"), lit(3)),
+			eq(ref("type_id"), lit(1)),
+		),
+	}, stmt)
+}
+
+func TestParseDuplicateAggregates(t *testing.T) {
+	stmt, err := parse(
+		"SELECT COUNT(*) FROM items HAVING count(*) < 3",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]*aggCall{{fn: "COUNT", arg: "*"}}, stmt.(*selectStmt).aggs,
+	)
+}
+
+func TestParseOrderByNulls(t *testing.T) {
+	stmt, err := parse("SELECT * FROM items ORDER BY price ASC NULLS FIRST")
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]sortKey{{column: "price", nullsFirst: true}},
+		stmt.(*selectStmt).orderBy,
+	)
+	stmt, err = parse("SELECT * FROM items ORDER BY price NULLS LAST")
+	assert.NoError(t, err)
+	assert.Equal(t, []sortKey{{column: "price"}}, stmt.(*selectStmt).orderBy)
+	_, err = parse("SELECT * FROM items ORDER BY price NULLS")
+	assert.Error(t, err)
+}
+
+func TestParseJoinKinds(t *testing.T) {
+	cases := []struct {
+		in  string
+		out joinKind
+	}{
+		{"JOIN", innerJoinKind},
+		{"INNER JOIN", innerJoinKind},
+		{"LEFT JOIN", leftJoinKind},
+		{"LEFT OUTER JOIN", leftJoinKind},
+		{"RIGHT JOIN", rightJoinKind},
+		{"RIGHT OUTER JOIN", rightJoinKind},
+		{"FULL JOIN", fullJoinKind},
+		{"FULL OUTER JOIN", fullJoinKind},
+	}
+	for _, c := range cases {
+		stmt, err := parse("SELECT * FROM items " + c.in + " types USING (id)")
+		if assert.NoError(t, err, c.in) {
+			assert.Equal(t, []*joinClause{{
+				kind: c.out, right: &tableRef{name: "types"},
+				keys: []joinKey{{"id", "id"}},
+			}}, stmt.(*selectStmt).joins, c.in)
+		}
+	}
+}
+
+func TestParseCrossJoin(t *testing.T) {
+	stmt, err := parse("SELECT * FROM items CROSS JOIN types")
+	assert.NoError(t, err)
+	assert.Equal(t, []*joinClause{{
+		kind: crossJoinKind, right: &tableRef{name: "types"},
+	}}, stmt.(*selectStmt).joins)
+}
+
+func TestParseJoinWithoutUsing(t *testing.T) {
+	_, err := parse("SELECT * FROM items JOIN types")
+	assert.Error(t, err)
+}
+
+func TestParseJoinOn(t *testing.T) {
+	stmt, err := parse(
+		"SELECT items.name FROM items JOIN types " +
+			"ON items.type_id = types.id AND size = types.size",
+	)
+	assert.NoError(t, err)
+	s := stmt.(*selectStmt)
+	assert.Equal(t, []string{"items.name"}, s.columns)
+	assert.Equal(t, []joinKey{
+		{"items.type_id", "types.id"},
+		{"size", "types.size"},
+	}, s.joins[0].keys)
+}
+
+func TestParseJoinUsingList(t *testing.T) {
+	stmt, err := parse("SELECT * FROM items JOIN types USING (a, b)")
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]joinKey{{"a", "a"}, {"b", "b"}}, stmt.(*selectStmt).joins[0].keys,
+	)
+}
+
+func TestParseJoinOnNotEquality(t *testing.T) {
+	_, err := parse("SELECT * FROM items JOIN types ON a < b")
+	assert.Error(t, err)
+}
+
+func TestParseQualifiedAggregate(t *testing.T) {
+	stmt, err := parse(
+		"SELECT items.type_id, SUM(items.price) FROM items " +
+			"GROUP BY items.type_id",
+	)
+	assert.NoError(t, err)
+	s := stmt.(*selectStmt)
+	assert.Equal(t, []string{"items.type_id", "sum(items.price)"}, s.columns)
+	assert.Equal(t, []string{"items.type_id"}, s.groupBy)
+}
+
+func TestParseOrderByKeys(t *testing.T) {
+	stmt, err := parse(
+		"SELECT * FROM items " +
+			"ORDER BY type_id, price DESC NULLS FIRST, name ASC",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []sortKey{
+		{column: "type_id"},
+		{column: "price", desc: true, nullsFirst: true},
+		{column: "name"},
+	}, stmt.(*selectStmt).orderBy)
+}
+
+func TestParseLimit(t *testing.T) {
+	stmt, err := parse("SELECT * FROM items LIMIT 10 OFFSET 20")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, *stmt.(*selectStmt).limit)
+	assert.Equal(t, 20, stmt.(*selectStmt).offset)
+}
+
+func TestParseLimitNotInteger(t *testing.T) {
+	_, err := parse("SELECT * FROM items LIMIT 1.5")
+	assert.Error(t, err)
+	_, err = parse("SELECT * FROM items LIMIT -1")
+	assert.Error(t, err)
+}
+
+func TestParseCreateChecks(t *testing.T) {
+	stmt, err := parse("CREATE TABLE items (id INTEGER NOT NULL DEFAULT 0, " +
+		"price CHECK (price >= 0), created DEFAULT CURRENT_TIMESTAMP, " +
+		"CHECK (id < price))")
+	assert.NoError(t, err)
+	assert.Equal(t, []constraintDef{
+		notNull("id"),
+		defaultTo("id", lit(0)),
+		checkDef{column: "price", cond: ge(ref("price"), lit(0))},
+		defaultTo("created", call("CURRENT_TIMESTAMP")),
+		checkExpr(lt(ref("id"), ref("price"))),
+	}, stmt.(*createStmt).constraints)
+	_, err = parse("CREATE TABLE items (id NOT 0)")
+	assert.Error(t, err)
+}
+
+func TestParseCreateAutoIncrement(t *testing.T) {
+	stmt, err := parse("CREATE TABLE items (id INTEGER AUTO_INCREMENT, " +
+		"no IDENTITY, n DEFAULT NEXTVAL('items_id_seq'))")
+	assert.NoError(t, err)
+	assert.Equal(t, []constraintDef{
+		autoIncrement("id"),
+		autoIncrement("no"),
+		defaultTo("n", call("NEXTVAL", lit("items_id_seq"))),
+	}, stmt.(*createStmt).constraints)
+}
+
+func TestParseTransaction(t *testing.T) {
+	for src, expected := range map[string]statement{
+		"BEGIN":                               &beginStmt{},
+		"BEGIN TRANSACTION":                   &beginStmt{},
+		"COMMIT":                              &commitStmt{},
+		"ROLLBACK":                            &rollbackStmt{},
+		"ROLLBACK TO a":                       &rollbackStmt{savepoint: "a"},
+		"ROLLBACK TRANSACTION TO SAVEPOINT a": &rollbackStmt{savepoint: "a"},
+		"SAVEPOINT a":                         &savepointStmt{name: "a"},
+		"RELEASE SAVEPOINT a":                 &releaseStmt{name: "a"},
+	} {
+		stmt, err := parse(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, stmt, src)
+	}
+	_, err := parse("SAVEPOINT")
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+)
+
+// sequence generates the values of an AUTO_INCREMENT column of a table,
+// which owns it. NEXTVAL('name') returns the next value of it.
+// the values stored in the column explicitly advance it past them,
+// so that it never generates the values already used.
+// the values generated are kept by the log, or by the file of the table
+// kept by its own one, so that they are not generated again after
+// a restart, even if no row has them
+type sequence struct {
+	name   string
+	column int
+	next   int
+	owner  *table
+	// saved is the value from which the file of the owner resumes
+	// the sequence, which is reserved ahead of next
+	saved int
+}
+
+// sequenceReserve is how many values are reserved at once
+// in the file of a table, not to rewrite it for every value
+const sequenceReserve = 32
+
+// nextValue returns the next value, which it keeps as used.
+// it cannot report the failure of keeping it, which the log keeps
+// to report by the succeeding mutations, and the table kept by its own
+// file reports by the next mutation trying it again
+func (s *sequence) nextValue() int {
+	v := s.next
+	s.next++
+	if _, ok := s.owner.store.(*memStore); ok {
+		if tables[s.owner.name] == s.owner {
+			journal.logSequence(s)
+		}
+	} else {
+		s.owner.saveSequences()
+	}
+	return v
+}
+
+// state is the value from which the sequence is resumed when loaded
+func (s *sequence) state() int {
+	if s.saved > s.next {
+		return s.saved
+	}
+	return s.next
+}
+
+func (s *sequence) advance(v interface{}) {
+	if n, ok := v.(int); ok && n >= s.next {
+		s.next = n + 1
+	}
+}
+
+// autoIncrementDef declares that the column is filled by a sequence
+// starting at 1, for the rows inserted without it
+type autoIncrementDef struct {
+	column string
+}
+
+func autoIncrement(colName string) autoIncrementDef {
+	return autoIncrementDef{column: colName}
+}
+
+func (d autoIncrementDef) addTo(t *table) error {
+	idx, err := t.lookupColumn(d.column)
+	if err != nil {
+		return err
+	}
+	c := t.columns[idx]
+	if c.typ != typeAny && c.typ != typeInteger {
+		return fmt.Errorf("%s.%s: AUTO_INCREMENT of %s", t.name, c.name, c.typ)
+	}
+	name := t.name + "_" + c.name + "_seq"
+	if findSequence(name) != nil || t.sequenceOn(idx) != nil {
+		return fmt.Errorf("sequence already exists: %s", name)
+	}
+	t.sequences = append(t.sequences, &sequence{
+		name: name, column: idx, next: 1, owner: t,
+	})
+	c.notNull = true
+	c.dflt = call("NEXTVAL", lit(name))
+	return nil
+}
+
+func (t *table) sequenceOn(idx int) *sequence {
+	for _, s := range t.sequences {
+		if s.column == idx {
+			return s
+		}
+	}
+	return nil
+}
+
+// findSequence returns the sequence of the name, or nil
+func findSequence(name string) *sequence {
+	for _, t := range tables {
+		for _, s := range t.sequences {
+			if s.name == name {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// advanceSequences advances the sequences of t past the values of the row
+func (t *table) advanceSequences(row []interface{}) {
+	for _, s := range t.sequences {
+		s.advance(row[s.column])
+	}
+}
+
+// saveSequences reserves the values of the sequences of t in its file,
+// if it is kept by its own one and they have run out of the reserved ones.
+// the rows of the largest values may have been deleted by the time
+// it is opened again, so they are not enough to resume the sequences
+func (t *table) saveSequences() error {
+	h, ok := t.store.(*heapFile)
+	if !ok {
+		return nil
+	}
+	saved := []int{}
+	reserve := false
+	for _, s := range t.sequences {
+		saved = append(saved, s.saved)
+		if s.next > s.saved {
+			s.saved = s.next + sequenceReserve
+			reserve = true
+		}
+	}
+	if !reserve {
+		return nil
+	}
+	if err := h.saveSchema(t); err != nil {
+		for i, s := range t.sequences {
+			s.saved = saved[i]
+		}
+		return err
+	}
+	return nil
+}
+
+// closeSequences writes the exact state of the sequences of t
+// into its file before it is closed, so that the values reserved
+// but not used are not skipped
+func (t *table) closeSequences() error {
+	h, ok := t.store.(*heapFile)
+	if !ok || len(t.sequences) == 0 {
+		return nil
+	}
+	for _, s := range t.sequences {
+		s.saved = s.next
+	}
+	return h.saveSchema(t)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestAutoIncrement(t *testing.T) {
+	tbl, _ := create("TestAutoIncrement", []string{"id", "name"},
+		autoIncrement("id"),
+	)
+	defer drop("TestAutoIncrement")
+	tbl.insertNamed(map[string]interface{}{"name": "apple"})
+	tbl.insertNamed(map[string]interface{}{"name": "orange"})
+	assert.Equal(t, []interface{}{1, 2}, ids(from(tbl)))
+	assert.IsType(t, &ErrConstraint{}, tbl.insert(nil, "cabbage"))
+}
+
+func TestAutoIncrementExplicit(t *testing.T) {
+	tbl, _ := create("TestAutoIncrementExplicit", []string{"id", "name"},
+		autoIncrement("id"),
+	)
+	defer drop("TestAutoIncrementExplicit")
+	tbl.insert(10, "apple")
+	tbl.insertNamed(map[string]interface{}{"name": "orange"})
+	tbl.update(from(tbl).equal("id", 10).load().tuples, map[string]interface{}{"id": 20})
+	tbl.insertNamed(map[string]interface{}{"name": "cabbage"})
+	assert.Equal(t, []interface{}{20, 11, 21}, ids(from(tbl)))
+}
+
+func TestNextVal(t *testing.T) {
+	tbl, _ := create("TestNextVal", []string{"id"}, autoIncrement("id"))
+	defer drop("TestNextVal")
+	other, _ := create("TestNextValOther", []string{"id"},
+		defaultTo("id", call("NEXTVAL", lit("TestNextVal_id_seq"))),
+	)
+	defer drop("TestNextValOther")
+	tbl.insertNamed(nil)
+	other.insertNamed(nil)
+	tbl.insertNamed(nil)
+	assert.Equal(t, []interface{}{1, 3}, ids(from(tbl)))
+	assert.Equal(t, []interface{}{2}, ids(from(other)))
+	_, err := create("TestNextValUnknown", []string{"id"},
+		defaultTo("id", call("NEXTVAL", lit("none"))),
+	)
+	assert.Error(t, err)
+}
+
+func TestInvalidAutoIncrement(t *testing.T) {
+	_, err := createTable("TestInvalidAutoIncrement",
+		[]columnDef{{"id", typeText}}, autoIncrement("id"),
+	)
+	assert.Error(t, err)
+	_, err = createTable("TestInvalidAutoIncrement",
+		[]columnDef{{"id", typeInteger}}, autoIncrement("id"), autoIncrement("id"),
+	)
+	assert.Error(t, err)
+}
+
+func TestSequenceSaveOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withCatalog(func() {
+		tbl, _ := create("items", []string{"id", "name"}, autoIncrement("id"))
+		tbl.insert(5, "apple")
+		tbl.delete(from(tbl).load().tuples)
+		assert.NoError(t, save(path))
+		tables = map[string]*table{}
+		assert.NoError(t, open(path))
+		tbl = tables["items"]
+		tbl.insertNamed(map[string]interface{}{"name": "orange"})
+		assert.Equal(t, []interface{}{6}, ids(from(tbl)),
+			"the deleted value should not be reused")
+	})
+}
+
+func TestSequencePagedTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	pool := newBufferPool(4)
+	tbl, _ := createPagedTable(
+		"TestSequencePagedTable", pagedDefs, path, pool, autoIncrement("id"),
+	)
+	tbl.insertNamed(map[string]interface{}{"name": "zero"})
+	tbl.insertNamed(map[string]interface{}{"name": "one"})
+	drop("TestSequencePagedTable")
+
+	tbl, err := openPagedTable(path, pool)
+	assert.NoError(t, err)
+	defer drop("TestSequencePagedTable")
+	tbl.insertNamed(map[string]interface{}{"name": "two"})
+	assert.Equal(t, []interface{}{1, 2, 3}, ids(from(tbl)))
+}
+
+func TestSequencePagedTableDeleted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	pool := newBufferPool(4)
+	tbl, _ := createPagedTable(
+		"TestSequencePagedTableDeleted", pagedDefs, path, pool,
+		autoIncrement("id"),
+	)
+	tbl.insert(10, "ten")
+	tbl.delete(from(tbl).load().tuples)
+	drop("TestSequencePagedTableDeleted")
+
+	tbl, err := openPagedTable(path, pool)
+	assert.NoError(t, err)
+	defer drop("TestSequencePagedTableDeleted")
+	tbl.insertNamed(map[string]interface{}{"name": "eleven"})
+	assert.Equal(t, []interface{}{11}, ids(from(tbl)),
+		"the value of the deleted row should not be reused")
+}
+
+func TestSequenceWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		exec("CREATE TABLE items (id INTEGER AUTO_INCREMENT, name TEXT)")
+		exec("INSERT INTO items (name) VALUES ('apple'), ('orange')")
+	})
+	withWAL(t, path, func() {
+		_, err := exec("INSERT INTO items (name) VALUES ('cabbage')")
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{1, 2, 3}, ids(from("items")))
+	})
+}
+
+func TestSequenceWALNextVal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		exec("CREATE TABLE items (id INTEGER AUTO_INCREMENT, name TEXT)")
+		exec("CREATE TABLE tags " +
+			"(id INTEGER DEFAULT NEXTVAL('items_id_seq'), name TEXT)")
+		_, err := exec("INSERT INTO tags (name) VALUES ('red'), ('blue')")
+		assert.NoError(t, err)
+	})
+	withWAL(t, path, func() {
+		exec("INSERT INTO items (name) VALUES ('apple')")
+		assert.Equal(t, []interface{}{3}, ids(from("items")),
+			"the values used by tags should not be reused")
+	})
+}
+
+func TestSequencePagedTableCrash(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.pages")
+	withWAL(t, filepath.Join(dir, "test.db"), func() {
+		tbl, _ := createPagedTable(
+			"paged", pagedDefs, path, newBufferPool(4), autoIncrement("id"),
+		)
+		defer drop("paged")
+		tbl.insertNamed(map[string]interface{}{"name": "one"})
+		tbl.insertNamed(map[string]interface{}{"name": "two"})
+		// the file is opened again without closing it, as if crashed
+		withCatalog(func() {
+			tbl, err := openPagedTable(path, newBufferPool(4))
+			if assert.NoError(t, err) {
+				defer drop("paged")
+				tbl.insertNamed(map[string]interface{}{"name": "three"})
+				assert.Equal(t, []interface{}{1, 2, 2 + sequenceReserve},
+					ids(from(tbl)), "the reserved values should be skipped")
+			}
+		})
+	})
+}
@@ -0,0 +1,748 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// the storage file consists of the magic header, the generation
+// of the checkpoint and the tables, each of which has its schema
+// followed by its tuples with their rowIDs and its indexes.
+// numbers are written as varints, and strings with their lengths
+const storageMagic = "CARAMELDB\x01"
+
+// byteWriter and byteReader are what the encoders use,
+// which both the files and the in-memory buffers satisfy
+type byteWriter interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// the tags of the values in the storage file
+const (
+	tagNull byte = iota
+	tagInt
+	tagFloat
+	tagText
+	tagBool
+	tagBlob
+)
+
+// save writes all the tables in the catalog to the file.
+// the file is replaced at once, so a crash never leaves it half-written
+func save(path string) error {
+	return saveSnapshot(path, 0)
+}
+
+// saveSnapshot is save recording the generation of the checkpoint,
+// by which the write-ahead log is checked to follow the snapshot.
+// it is not saved in a transaction, which may be rolled back
+func saveSnapshot(path string, gen uint64) error {
+	if activeTx != nil {
+		return fmt.Errorf("cannot save in a transaction")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	if err := writeCatalog(w, gen); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// open replaces the catalog by the tables read from the file.
+// the catalog is left as it is if the file cannot be read
+func open(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	loaded, _, err := readCatalog(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	tables = loaded
+	return nil
+}
+
+func writeCatalog(w *bufio.Writer, gen uint64) error {
+	if _, err := w.WriteString(storageMagic); err != nil {
+		return err
+	}
+	writeUvarint(w, gen)
+	// the tables kept by their own files are not in the snapshot
+	names := []string{}
+	for name, t := range tables {
+		if _, ok := t.store.(*memStore); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	writeUvarint(w, uint64(len(names)))
+	for _, name := range names {
+		if err := writeTable(w, tables[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTable writes the schema and the tuples of a table kept in memory,
+// and the definitions of its indexes, which are rebuilt when read
+func writeTable(w byteWriter, t *table) error {
+	writeSchema(w, t)
+	s := t.store.(*memStore)
+	writeUvarint(w, uint64(s.next))
+	writeUvarint(w, uint64(len(s.pos)))
+	err := s.scan(func(tup *tuple) error {
+		writeUvarint(w, uint64(tup.rid))
+		for _, v := range tup.values {
+			if err := writeValue(w, v); err != nil {
+				return fmt.Errorf("%s: %v", t.name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// the indexes of the constraints are made with the schema
+	ixs := []*index{}
+	for _, ix := range t.indexes {
+		if !ix.implicit {
+			ixs = append(ixs, ix)
+		}
+	}
+	writeUvarint(w, uint64(len(ixs)))
+	for _, ix := range ixs {
+		writeString(w, ix.name)
+		writeString(w, t.columns[ix.columns[0]].name)
+		w.WriteByte(byte(ix.kind))
+	}
+	return nil
+}
+
+// writeSchema writes the columns and the constraints of a table,
+// and the state of its sequences
+func writeSchema(w byteWriter, t *table) {
+	writeString(w, t.name)
+	writeUvarint(w, uint64(len(t.columns)))
+	for _, c := range t.columns {
+		writeString(w, c.name)
+		w.WriteByte(byte(c.typ))
+	}
+	writeUvarint(w, uint64(len(t.keys)))
+	for _, k := range t.keys {
+		writeBool(w, k.primary)
+		writeUvarint(w, uint64(len(k.columns)))
+		for _, idx := range k.columns {
+			writeUvarint(w, uint64(idx))
+		}
+	}
+	writeUvarint(w, uint64(len(t.foreignKeys)))
+	for _, fk := range t.foreignKeys {
+		writeUvarint(w, uint64(len(fk.columns)))
+		for _, idx := range fk.columns {
+			writeUvarint(w, uint64(idx))
+		}
+		writeString(w, fk.refTable)
+		for _, cn := range fk.refColumns {
+			writeString(w, cn)
+		}
+		w.WriteByte(byte(fk.onDelete))
+	}
+	// the expressions are checked to be written when they are declared
+	for _, c := range t.columns {
+		writeBool(w, c.notNull)
+		writeExpr(w, c.dflt)
+	}
+	writeUvarint(w, uint64(len(t.checks)))
+	for _, c := range t.checks {
+		writeString(w, c.name)
+		writeExpr(w, c.cond)
+	}
+	writeUvarint(w, uint64(len(t.sequences)))
+	for _, seq := range t.sequences {
+		writeString(w, seq.name)
+		writeUvarint(w, uint64(seq.column))
+		writeUvarint(w, uint64(seq.state()))
+	}
+}
+
+func readCatalog(r byteReader) (map[string]*table, uint64, error) {
+	magic := make([]byte, len(storageMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != storageMagic {
+		return nil, 0, fmt.Errorf("not a storage file")
+	}
+	gen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	loaded := map[string]*table{}
+	for i := uint64(0); i < n; i++ {
+		t, err := readTable(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		loaded[t.name] = t
+	}
+	return loaded, gen, nil
+}
+
+func readTable(r byteReader) (*table, error) {
+	t, err := readSchema(r)
+	if err != nil {
+		return nil, err
+	}
+	next, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	nTups, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	s := t.store.(*memStore)
+	for i := uint64(0); i < nTups; i++ {
+		rid, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]interface{}, len(t.columns))
+		for j := range vals {
+			if vals[j], err = readValue(r); err != nil {
+				return nil, fmt.Errorf("%s: %v", t.name, err)
+			}
+		}
+		s.put(rowID(rid), vals)
+	}
+	// the rowIDs of the deleted rows are not reused
+	s.next = rowID(next)
+	if err := t.reindex(); err != nil {
+		return nil, err
+	}
+	nIdxs, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < nIdxs; i++ {
+		ixName, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		colName, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		idx, err := t.lookupColumn(colName)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.name, err)
+		}
+		if _, err := t.buildIndex(ixName, idx, indexKind(kind)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// readSchema makes a table kept in memory, which has no tuples yet.
+// the indexes of its keys have to be filled if the tuples are loaded
+// into the storage directly
+func readSchema(r byteReader) (*table, error) {
+	name, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	nCols, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	cols := []*column{}
+	for i := uint64(0); i < nCols; i++ {
+		colName, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		typ, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		c := newColumn("", colName)
+		c.typ = colType(typ)
+		cols = append(cols, c)
+	}
+	t := newTable(name, cols)
+	nKeys, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < nKeys; i++ {
+		primary, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		k := keyDef{primary: primary != 0}
+		for j := uint64(0); j < n; j++ {
+			idx, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			if idx >= uint64(len(cols)) {
+				return nil, fmt.Errorf("%s: key of unknown column", name)
+			}
+			k.columns = append(k.columns, cols[idx].name)
+		}
+		if err := t.addKey(k); err != nil {
+			return nil, err
+		}
+	}
+	nFKs, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < nFKs; i++ {
+		fk, err := readForeignKey(r, t)
+		if err != nil {
+			return nil, err
+		}
+		t.foreignKeys = append(t.foreignKeys, fk)
+	}
+	for _, c := range cols {
+		notNull, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		c.notNull = notNull != 0
+		if c.dflt, err = readExpr(r); err != nil {
+			return nil, err
+		}
+	}
+	nChecks, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < nChecks; i++ {
+		name, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		cond, err := readExpr(r)
+		if err != nil {
+			return nil, err
+		}
+		if cond == nil {
+			return nil, fmt.Errorf("%s: CHECK of no condition", name)
+		}
+		if err := t.addCheck(name, cond); err != nil {
+			return nil, err
+		}
+	}
+	nSeqs, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < nSeqs; i++ {
+		seq := &sequence{}
+		if seq.name, err = readString(r); err != nil {
+			return nil, err
+		}
+		idx, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if idx >= uint64(len(cols)) {
+			return nil, fmt.Errorf("%s: sequence of unknown column", name)
+		}
+		next, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		seq.column, seq.next, seq.saved = int(idx), int(next), int(next)
+		seq.owner = t
+		t.sequences = append(t.sequences, seq)
+	}
+	return t, nil
+}
+
+// readForeignKey reads a foreign key of t, without checking the referenced
+// table, which may be loaded after t
+func readForeignKey(r byteReader, t *table) (*foreignKey, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	fk := &foreignKey{}
+	names := []string{}
+	for j := uint64(0); j < n; j++ {
+		idx, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if idx >= uint64(len(t.columns)) {
+			return nil, fmt.Errorf("%s: foreign key of unknown column", t.name)
+		}
+		fk.columns = append(fk.columns, int(idx))
+		names = append(names, t.columns[idx].name)
+	}
+	if fk.refTable, err = readString(r); err != nil {
+		return nil, err
+	}
+	for j := uint64(0); j < n; j++ {
+		cn, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		fk.refColumns = append(fk.refColumns, cn)
+	}
+	action, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if int(action) >= len(fkActionNames) {
+		return nil, fmt.Errorf("%s: unknown action: %d", t.name, action)
+	}
+	fk.onDelete = fkAction(action)
+	fk.name = foreignKeyName(t.name, names)
+	return fk, nil
+}
+
+// the errors of bufio.Writer are sticky, and checked by Flush at last.
+// bytes.Buffer never fails to write
+func writeUvarint(w byteWriter, n uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	w.Write(buf[:binary.PutUvarint(buf, n)])
+}
+
+func writeString(w byteWriter, s string) {
+	writeUvarint(w, uint64(len(s)))
+	w.WriteString(s)
+}
+
+func readString(r byteReader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	// the length may be corrupted, so the buffer grows only
+	// as the bytes are read, instead of being allocated in advance
+	if n > math.MaxInt32 {
+		return "", fmt.Errorf("string too long: %d bytes", n)
+	}
+	buf := &bytes.Buffer{}
+	if _, err := io.CopyN(buf, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func writeValue(w byteWriter, v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		w.WriteByte(tagNull)
+	case int:
+		w.WriteByte(tagInt)
+		buf := make([]byte, binary.MaxVarintLen64)
+		w.Write(buf[:binary.PutVarint(buf, int64(x))])
+	case float64:
+		w.WriteByte(tagFloat)
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, math.Float64bits(x))
+		w.Write(buf)
+	case string:
+		w.WriteByte(tagText)
+		writeString(w, x)
+	case bool:
+		w.WriteByte(tagBool)
+		if x {
+			w.WriteByte(1)
+		} else {
+			w.WriteByte(0)
+		}
+	case []byte:
+		w.WriteByte(tagBlob)
+		writeString(w, string(x))
+	default:
+		return fmt.Errorf("cannot store %#v", v)
+	}
+	return nil
+}
+
+func readValue(r byteReader) (interface{}, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagNull:
+		return nil, nil
+	case tagInt:
+		n, err := binary.ReadVarint(r)
+		return int(n), err
+	case tagFloat:
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(buf)), nil
+	case tagText:
+		return readString(r)
+	case tagBool:
+		b, err := r.ReadByte()
+		return b != 0, err
+	case tagBlob:
+		s, err := readString(r)
+		return []byte(s), err
+	}
+	return nil, fmt.Errorf("unknown value tag: %d", tag)
+}
+
+// the tags of the nodes of the expressions in the storage file
+const (
+	tagNoExpr byte = iota
+	tagColRef
+	tagLiteral
+	tagComparison
+	tagAnd
+	tagOr
+	tagNot
+	tagIsNull
+	tagIn
+	tagBetween
+	tagLike
+	tagCall
+)
+
+// writeExpr writes an expression tree, which may be nil, in prefix order
+func writeExpr(w byteWriter, e expr) error {
+	switch x := e.(type) {
+	case nil:
+		w.WriteByte(tagNoExpr)
+	case *colRef:
+		w.WriteByte(tagColRef)
+		writeString(w, x.name)
+	case *literal:
+		w.WriteByte(tagLiteral)
+		return writeValue(w, x.value)
+	case *comparison:
+		w.WriteByte(tagComparison)
+		writeString(w, x.op)
+		return writeExprs(w, x.left, x.right)
+	case *andExpr:
+		w.WriteByte(tagAnd)
+		writeUvarint(w, uint64(len(x.operands)))
+		return writeExprs(w, x.operands...)
+	case *orExpr:
+		w.WriteByte(tagOr)
+		writeUvarint(w, uint64(len(x.operands)))
+		return writeExprs(w, x.operands...)
+	case *notExpr:
+		w.WriteByte(tagNot)
+		return writeExpr(w, x.operand)
+	case *isNullExpr:
+		w.WriteByte(tagIsNull)
+		writeBool(w, x.negated)
+		return writeExpr(w, x.operand)
+	case *inExpr:
+		w.WriteByte(tagIn)
+		writeBool(w, x.negated)
+		writeUvarint(w, uint64(len(x.list)))
+		return writeExprs(w, append([]expr{x.operand}, x.list...)...)
+	case *betweenExpr:
+		w.WriteByte(tagBetween)
+		writeBool(w, x.negated)
+		return writeExprs(w, x.operand, x.low, x.high)
+	case *likeExpr:
+		w.WriteByte(tagLike)
+		writeBool(w, x.negated)
+		return writeExprs(w, x.operand, x.pattern)
+	case *callExpr:
+		w.WriteByte(tagCall)
+		writeString(w, x.name)
+		writeUvarint(w, uint64(len(x.args)))
+		return writeExprs(w, x.args...)
+	default:
+		return fmt.Errorf("cannot store %T", e)
+	}
+	return nil
+}
+
+func writeExprs(w byteWriter, es ...expr) error {
+	for _, e := range es {
+		if err := writeExpr(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeBool(w byteWriter, b bool) {
+	if b {
+		w.WriteByte(1)
+	} else {
+		w.WriteByte(0)
+	}
+}
+
+func readExpr(r byteReader) (expr, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagNoExpr:
+		return nil, nil
+	case tagColRef:
+		name, err := readString(r)
+		return ref(name), err
+	case tagLiteral:
+		v, err := readValue(r)
+		return lit(v), err
+	case tagComparison:
+		op, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		es, err := readExprs(r, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &comparison{op: op, left: es[0], right: es[1]}, nil
+	case tagAnd, tagOr:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		es, err := readExprs(r, n)
+		if err != nil {
+			return nil, err
+		}
+		if tag == tagAnd {
+			return and(es...), nil
+		}
+		return or(es...), nil
+	case tagNot:
+		es, err := readExprs(r, 1)
+		if err != nil {
+			return nil, err
+		}
+		return not(es[0]), nil
+	case tagCall:
+		name, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		es, err := readExprs(r, n)
+		if err != nil {
+			return nil, err
+		}
+		return call(name, es...), nil
+	}
+	// the others are negated predicates
+	negated, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagIsNull:
+		es, err := readExprs(r, 1)
+		if err != nil {
+			return nil, err
+		}
+		return &isNullExpr{operand: es[0], negated: negated != 0}, nil
+	case tagIn:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		es, err := readExprs(r, n+1)
+		if err != nil {
+			return nil, err
+		}
+		return &inExpr{operand: es[0], list: es[1:], negated: negated != 0}, nil
+	case tagBetween:
+		es, err := readExprs(r, 3)
+		if err != nil {
+			return nil, err
+		}
+		return &betweenExpr{
+			operand: es[0], low: es[1], high: es[2], negated: negated != 0,
+		}, nil
+	case tagLike:
+		es, err := readExprs(r, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &likeExpr{
+			operand: es[0], pattern: es[1], negated: negated != 0,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown expression tag: %d", tag)
+}
+
+// readExprs reads n expressions, none of which is nil
+func readExprs(r byteReader, n uint64) ([]expr, error) {
+	es := []expr{}
+	for i := uint64(0); i < n; i++ {
+		e, err := readExpr(r)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			return nil, fmt.Errorf("missing operand")
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
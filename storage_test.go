@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withCatalog runs f with an empty catalog, restoring the original after it
+func withCatalog(f func()) {
+	old := tables
+	defer func() { tables = old }()
+	tables = map[string]*table{}
+	f()
+}
+
+// scanCatalog scans all the tables in the catalog, to compare the rows
+// regardless of how the storages keep them
+func scanCatalog() map[string]*relation {
+	scanned := map[string]*relation{}
+	for name, t := range tables {
+		r := from(t).load()
+		scanned[name] = newRelation(r.columns, r.tuples)
+	}
+	return scanned
+}
+
+func TestSaveOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withCatalog(func() {
+		typed, _ := createTable("typed", []columnDef{
+			{"id", typeInteger}, {"price", typeReal}, {"name", typeText},
+			{"ok", typeBoolean}, {"data", typeBlob},
+		})
+		typed.insert(-1, 1.5, "apple", true, []byte{0, 255})
+		typed.insert(1<<40, nil, "", false, []byte{})
+		untyped, _ := create("untyped", []string{"any"})
+		untyped.insert(nil)
+		create("empty", []string{})
+		assert.NoError(t, save(path))
+
+		saved := scanCatalog()
+		tables = map[string]*table{}
+		assert.NoError(t, open(path))
+		assert.Equal(t, saved, scanCatalog())
+	})
+}
+
+func TestOpenNotExist(t *testing.T) {
+	err := open(filepath.Join(t.TempDir(), "none.db"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withCatalog(func() {
+		tbl, _ := create("TestOpenCorrupt", []string{"id", "name"})
+		tbl.insert(0, "zero")
+		assert.NoError(t, save(path))
+		data, _ := os.ReadFile(path)
+		os.WriteFile(path, data[:len(data)-2], 0644)
+		tables = map[string]*table{}
+		assert.Error(t, open(path))
+		assert.Equal(t, 0, len(tables), "it should keep the catalog")
+
+		os.WriteFile(path, []byte("garbage"), 0644)
+		assert.Error(t, open(path))
+	})
+}
+
+func TestOpenCorruptLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withCatalog(func() {
+		buf := &bytes.Buffer{}
+		buf.WriteString(storageMagic)
+		writeUvarint(buf, 0)
+		writeUvarint(buf, 1)
+		// the name of the table claims far more bytes than the file has
+		writeUvarint(buf, 1<<30)
+		buf.WriteString("items")
+		os.WriteFile(path, buf.Bytes(), 0644)
+		assert.Error(t, open(path))
+		assert.Equal(t, 0, len(tables), "it should keep the catalog")
+	})
+}
+
+func TestSaveUnstorable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withCatalog(func() {
+		tbl, _ := create("TestSaveUnstorable", []string{"id"})
+		tbl.insert(struct{}{})
+		assert.Error(t, save(path))
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
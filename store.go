@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+)
+
+// rowID identifies a row in the storage of a table. the tuples scanned
+// from a table carry their rowIDs, and the others have none of them
+type rowID int64
+
+const noRowID rowID = 0
+
+// errNoRow is reported for a rowID which is not in the storage,
+// e.g. of a row deleted after it has been scanned
+var errNoRow = errors.New("no such row")
+
+// storage is the engine which keeps the rows of a table.
+// the rows are validated by the table before they are stored
+type storage interface {
+	scan(f func(tup *tuple) error) error
+	fetch(rid rowID) (*tuple, error)
+	insert(row []interface{}) (*tuple, error)
+	// update keeps the rowID of the row
+	update(rid rowID, row []interface{}) (*tuple, error)
+	delete(rid rowID) error
+	close() error
+}
+
+// indexedStorage is implemented by the engines which can find the rows
+// by the value of a column by themselves. ok is false if the engine
+// cannot look up the column, and then the rows are scanned
+type indexedStorage interface {
+	storage
+	lookup(colIdx int, key interface{}) (tups []*tuple, ok bool, err error)
+}
+
+// memStore is the default engine, which keeps the tuples in memory.
+// the tuples are never modified but replaced, since they are shared
+// with the relations scanned from the store
+type memStore struct {
+	tuples  []*tuple // nil for the deleted ones until compacted
+	pos     map[rowID]int
+	deleted int
+	next    rowID
+}
+
+func newMemStore() *memStore {
+	return &memStore{tuples: []*tuple{}, pos: map[rowID]int{}}
+}
+
+func (s *memStore) scan(f func(tup *tuple) error) error {
+	for _, tup := range s.tuples {
+		if tup == nil {
+			continue
+		}
+		if err := f(tup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memStore) fetch(rid rowID) (*tuple, error) {
+	i, ok := s.pos[rid]
+	if !ok {
+		return nil, errNoRow
+	}
+	return s.tuples[i], nil
+}
+
+func (s *memStore) insert(row []interface{}) (*tuple, error) {
+	s.next++
+	return s.put(s.next, row), nil
+}
+
+// put stores the row by the rowID, which is how a snapshot is loaded
+func (s *memStore) put(rid rowID, row []interface{}) *tuple {
+	tup := &tuple{values: row, rid: rid}
+	s.pos[rid] = len(s.tuples)
+	s.tuples = append(s.tuples, tup)
+	if rid > s.next {
+		s.next = rid
+	}
+	return tup
+}
+
+func (s *memStore) update(rid rowID, row []interface{}) (*tuple, error) {
+	i, ok := s.pos[rid]
+	if !ok {
+		return nil, errNoRow
+	}
+	tup := &tuple{values: row, rid: rid}
+	s.tuples[i] = tup
+	return tup, nil
+}
+
+func (s *memStore) delete(rid rowID) error {
+	i, ok := s.pos[rid]
+	if !ok {
+		return errNoRow
+	}
+	s.tuples[i] = nil
+	delete(s.pos, rid)
+	s.deleted++
+	if s.deleted > len(s.tuples)/2 {
+		s.compact()
+	}
+	return nil
+}
+
+func (s *memStore) compact() {
+	newTups := []*tuple{}
+	for _, tup := range s.tuples {
+		if tup != nil {
+			s.pos[tup.rid] = len(newTups)
+			newTups = append(newTups, tup)
+		}
+	}
+	s.tuples = newTups
+	s.deleted = 0
+}
+
+// clone copies the state of s, sharing the tuples
+func (s *memStore) clone() *memStore {
+	c := *s
+	c.tuples = append([]*tuple{}, s.tuples...)
+	c.pos = map[rowID]int{}
+	for rid, i := range s.pos {
+		c.pos[rid] = i
+	}
+	return &c
+}
+
+func (s *memStore) close() error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMemStoreRowIDs(t *testing.T) {
+	s := newMemStore()
+	a, _ := s.insert([]interface{}{0})
+	b, _ := s.insert([]interface{}{1})
+	assert.Equal(t, rowID(1), a.rid)
+	assert.Equal(t, rowID(2), b.rid)
+	assert.NoError(t, s.delete(a.rid))
+	c, _ := s.insert([]interface{}{2})
+	assert.Equal(t, rowID(3), c.rid, "it should not reuse the rowIDs")
+}
+
+func TestMemStoreUpdate(t *testing.T) {
+	s := newMemStore()
+	old, _ := s.insert([]interface{}{0})
+	tup, err := s.update(old.rid, []interface{}{1})
+	assert.NoError(t, err)
+	assert.Equal(t, old.rid, tup.rid)
+	assert.Equal(t, []interface{}{0}, old.values, "it should not modify the tuple")
+	cur, _ := s.fetch(old.rid)
+	assert.Equal(t, []interface{}{1}, cur.values)
+}
+
+func TestMemStoreNoRow(t *testing.T) {
+	s := newMemStore()
+	tup, _ := s.insert([]interface{}{0})
+	assert.NoError(t, s.delete(tup.rid))
+	_, err := s.fetch(tup.rid)
+	assert.Equal(t, errNoRow, err)
+	_, err = s.update(tup.rid, []interface{}{1})
+	assert.Equal(t, errNoRow, err)
+	assert.Equal(t, errNoRow, s.delete(tup.rid))
+}
+
+func TestMemStoreCompact(t *testing.T) {
+	s := newMemStore()
+	for i := 0; i < 10; i++ {
+		s.insert([]interface{}{i})
+	}
+	for rid := rowID(1); rid <= 6; rid++ {
+		assert.NoError(t, s.delete(rid))
+	}
+	assert.Equal(t, 4, len(s.tuples))
+	assert.Equal(t, 0, s.deleted)
+	tup, err := s.fetch(10)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{9}, tup.values)
+}
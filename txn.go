@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// transaction makes the mutations of the catalog between begin and commit
+// atomic. the records of the mutations are kept until the commit, and then
+// logged as a single record, so that a crash never replays some of them.
+// the state of each table is saved before its first mutation after
+// each savepoint, and restored by the rollback to the savepoint.
+// the tables kept by their own files are not transactional:
+// they cannot be modified in a transaction, and are created, opened
+// and dropped regardless of the rollbacks.
+// the sequences are not rolled back, so their values are never reused
+type transaction struct {
+	savepoints []*savepoint // the first one is the beginning
+	records    [][]byte
+	// statement is set for the transaction of a single statement,
+	// which may modify the tables kept by their own files without them
+	// being rolled back
+	statement bool
+}
+
+// savepoint is the state of the catalog at a point of the transaction
+type savepoint struct {
+	name    string
+	catalog map[string]*table
+	saved   map[*table]*tableState
+	records int
+}
+
+// tableState is the state of a table saved for the rollback.
+// the indexes are rebuilt from the rows when restored
+type tableState struct {
+	store   *memStore
+	indexes []*index
+}
+
+// activeTx is the transaction in progress, if any
+var activeTx *transaction
+
+var errNoTransaction = errors.New("no transaction in progress")
+
+// begin starts a transaction, which cannot be nested
+func begin() (*transaction, error) {
+	if activeTx != nil {
+		return nil, fmt.Errorf("transaction already in progress")
+	}
+	if err := journal.failure(); err != nil {
+		return nil, err
+	}
+	tx := &transaction{}
+	tx.push("")
+	activeTx = tx
+	return tx, nil
+}
+
+func (tx *transaction) push(name string) {
+	catalog := map[string]*table{}
+	for tn, t := range tables {
+		catalog[tn] = t
+	}
+	tx.savepoints = append(tx.savepoints, &savepoint{
+		name:    name,
+		catalog: catalog,
+		saved:   map[*table]*tableState{},
+		records: len(tx.records),
+	})
+}
+
+func (tx *transaction) check() error {
+	if activeTx != tx {
+		return fmt.Errorf("transaction already ended")
+	}
+	return nil
+}
+
+// track saves the state of t before it is modified,
+// unless it has been saved since the last savepoint
+func (tx *transaction) track(t *table) error {
+	s, ok := t.store.(*memStore)
+	if !ok && tx.statement {
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("%s: not modifiable in a transaction", t.name)
+	}
+	sp := tx.savepoints[len(tx.savepoints)-1]
+	if sp.saved[t] == nil {
+		sp.saved[t] = &tableState{
+			store:   s.clone(),
+			indexes: append([]*index{}, t.indexes...),
+		}
+	}
+	return nil
+}
+
+// commit logs the records of the transaction, or rolls it back
+// if they cannot be logged
+func (tx *transaction) commit() error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	activeTx = nil
+	if len(tx.records) == 0 {
+		return nil
+	}
+	if err := journal.log(batchRecord(tx.records)); err != nil {
+		tx.restore(tx.savepoints[0])
+		return err
+	}
+	return nil
+}
+
+// rollback discards all the mutations of the transaction
+func (tx *transaction) rollback() error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	activeTx = nil
+	tx.restore(tx.savepoints[0])
+	return nil
+}
+
+// savepoint marks the point to which the transaction can be rolled back.
+// the savepoint of the same name as an earlier one hides it until released
+func (tx *transaction) savepoint(name string) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	tx.push(name)
+	return nil
+}
+
+// rollbackTo discards the mutations after the savepoint, which is kept,
+// and releases the later savepoints
+func (tx *transaction) rollbackTo(name string) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	sp := tx.savepoints[i]
+	tx.restore(sp)
+	tx.savepoints = tx.savepoints[:i+1]
+	sp.saved = map[*table]*tableState{}
+	return nil
+}
+
+// release forgets the savepoint and the later ones, keeping the mutations.
+// the states saved after them are kept for the earlier savepoints
+func (tx *transaction) release(name string) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	tx.pop(i)
+	return nil
+}
+
+// pop forgets the savepoints from i, handing the states saved after them
+// to the one before
+func (tx *transaction) pop(i int) {
+	prev := tx.savepoints[i-1]
+	for _, sp := range tx.savepoints[i:] {
+		for t, st := range sp.saved {
+			if prev.saved[t] == nil {
+				prev.saved[t] = st
+			}
+		}
+	}
+	tx.savepoints = tx.savepoints[:i]
+}
+
+// atomically runs f, which makes the mutations of a statement,
+// so that they are logged as a single record and are rolled back
+// together if it fails. in a transaction, they are rolled back
+// to where f started, and are logged with the transaction
+func atomically(f func() error) error {
+	if tx := activeTx; tx != nil {
+		tx.push("")
+		i := len(tx.savepoints) - 1
+		if err := f(); err != nil {
+			tx.restore(tx.savepoints[i])
+			tx.savepoints = tx.savepoints[:i]
+			return err
+		}
+		tx.pop(i)
+		return nil
+	}
+	tx, err := begin()
+	if err != nil {
+		return err
+	}
+	tx.statement = true
+	if err := f(); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit()
+}
+
+// findSavepoint returns the position of the latest savepoint of the name
+func (tx *transaction) findSavepoint(name string) (int, error) {
+	for i := len(tx.savepoints) - 1; i > 0; i-- {
+		if tx.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown savepoint: %s", name)
+}
+
+// restore brings the catalog back to the savepoint, restoring the tables
+// saved after it, the latest ones first
+func (tx *transaction) restore(sp *savepoint) {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		for t, st := range tx.savepoints[i].saved {
+			t.store = st.store
+			t.indexes = st.indexes
+			t.reindex()
+			t.version++
+		}
+		if tx.savepoints[i] == sp {
+			break
+		}
+	}
+	catalog := map[string]*table{}
+	for name, t := range sp.catalog {
+		if _, ok := t.store.(*memStore); ok {
+			catalog[name] = t
+		}
+	}
+	for name, t := range tables {
+		if _, ok := t.store.(*memStore); !ok {
+			catalog[name] = t
+		}
+	}
+	tables = catalog
+	tx.records = tx.records[:sp.records]
+}
+
+// batchRecord is the record of the mutations of a transaction
+func batchRecord(records [][]byte) *bytes.Buffer {
+	rec := &bytes.Buffer{}
+	rec.WriteByte(recBatch)
+	writeUvarint(rec, uint64(len(records)))
+	for _, r := range records {
+		writeString(rec, string(r))
+	}
+	return rec
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransactionCommit(t *testing.T) {
+	withCatalog(func() {
+		tbl, _ := create("items", []string{"id", "name"})
+		tx, err := begin()
+		assert.NoError(t, err)
+		tbl.insert(0, "apple")
+		create("types", []string{"id"})
+		assert.NoError(t, tx.commit())
+		assert.Equal(t, 1, len(from(tbl).tuples))
+		assert.NotNil(t, tables["types"])
+		assert.Error(t, tx.rollback(), "the transaction should have ended")
+	})
+}
+
+func TestTransactionRollback(t *testing.T) {
+	withCatalog(func() {
+		tbl, _ := create("items", []string{"id", "name"}, primaryKey("id"))
+		tbl.createIndex("items_name", "name", btreeIndex)
+		tbl.insert(0, "apple")
+		tbl.insert(1, "orange")
+		tbl.insert(2, "cabbage")
+		create("types", []string{"id"})
+		before := scanCatalog()
+
+		tx, _ := begin()
+		tbl.insert(3, "saury")
+		tbl.update(from(tbl).equal("id", 0).tuples,
+			map[string]interface{}{"name": "lemon"},
+		)
+		tbl.delete(from(tbl).equal("id", 1).tuples)
+		tbl.createIndex("items_id", "id", hashIndex)
+		create("orders", []string{"id"})
+		drop("types")
+		assert.NoError(t, tx.rollback())
+
+		assert.Equal(t, before, scanCatalog())
+		assert.Equal(t, 1, len(tbl.indexes)-len(tbl.keys))
+		assert.Equal(t, []interface{}{0, 2, 1}, ids(from(tbl).orderBy("name")))
+		assert.Equal(t, []interface{}{1},
+			ids(from(tbl).where(eq(ref("name"), lit("orange")))))
+		assert.Error(t, tbl.insert(1, "lemon"), "the key should be restored")
+		assert.NoError(t, tbl.insert(3, "saury"))
+	})
+}
+
+func TestSavepoint(t *testing.T) {
+	withCatalog(func() {
+		tbl, _ := create("items", []string{"id"})
+		tx, _ := begin()
+		tbl.insert(0)
+		tx.savepoint("a")
+		tbl.insert(1)
+		tx.savepoint("b")
+		tbl.insert(2)
+		create("types", []string{"id"})
+		assert.NoError(t, tx.rollbackTo("a"))
+		assert.Equal(t, []interface{}{0}, ids(from(tbl)))
+		assert.Nil(t, tables["types"])
+		assert.Error(t, tx.rollbackTo("b"), "b should have been released")
+
+		tbl.insert(3)
+		assert.NoError(t, tx.rollbackTo("a"), "a should be kept")
+		assert.Equal(t, []interface{}{0}, ids(from(tbl)))
+		assert.NoError(t, tx.commit())
+		assert.Equal(t, []interface{}{0}, ids(from(tbl)))
+	})
+}
+
+func TestReleaseSavepoint(t *testing.T) {
+	withCatalog(func() {
+		tbl, _ := create("items", []string{"id"})
+		tbl.insert(0)
+		tx, _ := begin()
+		tx.savepoint("a")
+		tbl.insert(1)
+		assert.NoError(t, tx.release("a"))
+		assert.Error(t, tx.rollbackTo("a"))
+		assert.Equal(t, []interface{}{0, 1}, ids(from(tbl)))
+		tx.rollback()
+		assert.Equal(t, []interface{}{0}, ids(from(tbl)),
+			"the mutations after the released savepoint should be rolled back")
+	})
+}
+
+func TestNestedTransaction(t *testing.T) {
+	tx, err := begin()
+	assert.NoError(t, err)
+	defer tx.rollback()
+	_, err = begin()
+	assert.Error(t, err)
+}
+
+func TestTransactionPagedTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pages")
+	tbl, _ := createPagedTable(
+		"TestTransactionPagedTable", pagedDefs, path, newBufferPool(4),
+	)
+	defer drop("TestTransactionPagedTable")
+	tx, _ := begin()
+	defer tx.rollback()
+	assert.Error(t, tbl.insert(0, "zero"))
+	assert.Equal(t, 0, len(from(tbl).tuples))
+}
+
+func TestTransactionWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		exec("CREATE TABLE items (id INTEGER, name TEXT)")
+		tx, _ := begin()
+		exec("INSERT INTO items VALUES (0, 'apple'), (1, 'orange')")
+		exec("DELETE FROM items WHERE id = 0")
+		assert.Error(t, checkpoint(), "uncommitted rows should not be saved")
+		assert.NoError(t, tx.commit())
+		tx, _ = begin()
+		exec("INSERT INTO items VALUES (2, 'cabbage')")
+		tx.rollback()
+		exec("INSERT INTO items VALUES (3, 'saury')")
+		begin()
+		exec("INSERT INTO items VALUES (4, 'lemon')")
+		// the log is closed without the commit, as if crashed
+		activeTx = nil
+	})
+	withWAL(t, path, func() {
+		assert.Equal(t, []interface{}{1, 3}, ids(from("items")))
+	})
+}
+
+func TestExecTransaction(t *testing.T) {
+	withCatalog(func() {
+		tbl, _ := create("items", []string{"id"})
+		for _, src := range []string{
+			"BEGIN",
+			"INSERT INTO items VALUES (0)",
+			"SAVEPOINT a",
+			"INSERT INTO items VALUES (1)",
+			"ROLLBACK TO SAVEPOINT a",
+			"INSERT INTO items VALUES (2)",
+			"RELEASE a",
+			"COMMIT",
+		} {
+			_, err := exec(src)
+			assert.NoError(t, err, src)
+		}
+		assert.Equal(t, []interface{}{0, 2}, ids(from(tbl)))
+		_, err := exec("COMMIT")
+		assert.Error(t, err)
+		_, err = exec("ROLLBACK")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// colType is the declared type of a column.
+// the columns made by create are of typeAny and accept any value
+type colType int
+
+const (
+	typeAny colType = iota
+	typeInteger
+	typeReal
+	typeText
+	typeBoolean
+	typeBlob
+)
+
+var colTypeNames = []string{"ANY", "INTEGER", "REAL", "TEXT", "BOOLEAN", "BLOB"}
+
+func (ct colType) String() string {
+	if ct < 0 || int(ct) >= len(colTypeNames) {
+		return fmt.Sprintf("colType(%d)", int(ct))
+	}
+	return colTypeNames[ct]
+}
+
+var colTypeAliases = map[string]colType{
+	"INT": typeInteger, "FLOAT": typeReal, "DOUBLE": typeReal,
+	"VARCHAR": typeText, "BOOL": typeBoolean,
+}
+
+func parseColType(name string) (colType, error) {
+	name = strings.ToUpper(name)
+	for i, n := range colTypeNames {
+		if n == name {
+			return colType(i), nil
+		}
+	}
+	if ct, ok := colTypeAliases[name]; ok {
+		return ct, nil
+	}
+	return typeAny, fmt.Errorf("unknown type: %s", name)
+}
+
+// convert checks that v can be stored in a column of the type,
+// and returns the value to be stored. NULL is of any type
+func (ct colType) convert(v interface{}) (interface{}, error) {
+	if v == nil || ct == typeAny {
+		return v, nil
+	}
+	ok := false
+	switch ct {
+	case typeInteger:
+		_, ok = v.(int)
+	case typeReal:
+		if n, isInt := v.(int); isInt {
+			return float64(n), nil
+		}
+		_, ok = v.(float64)
+	case typeText:
+		_, ok = v.(string)
+	case typeBoolean:
+		_, ok = v.(bool)
+	case typeBlob:
+		_, ok = v.([]byte)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%#v is not %s", v, ct)
+	}
+	return v, nil
+}
+
+type columnDef struct {
+	name string
+	typ  colType
+}
+
+// createTable registers a new table whose columns have declared types,
+// with the constraints
+func createTable(
+	name string, defs []columnDef, cons ...constraintDef,
+) (*table, error) {
+	t, err := newTypedTable(name, defs, cons...)
+	if err != nil {
+		return nil, err
+	}
+	if err := journal.log(createRecord(t)); err != nil {
+		return nil, err
+	}
+	tables[name] = t
+	return t, nil
+}
+
+func newTypedTable(
+	name string, defs []columnDef, cons ...constraintDef,
+) (*table, error) {
+	cols := []*column{}
+	for i, d := range defs {
+		for _, prev := range defs[:i] {
+			if prev.name == d.name {
+				return nil, fmt.Errorf("duplicate column: %s", d.name)
+			}
+		}
+		c := newColumn("", d.name)
+		c.typ = d.typ
+		cols = append(cols, c)
+	}
+	t := newTable(name, cols)
+	for _, c := range cons {
+		if err := c.addTo(t); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// validate checks the arity and the types of a row to be stored in t,
+// and returns the values converted to the column types
+func (t *table) validate(vals []interface{}) ([]interface{}, error) {
+	if len(vals) != len(t.columns) {
+		return nil, fmt.Errorf(
+			"%s: %d values for %d columns", t.name, len(vals), len(t.columns),
+		)
+	}
+	row := make([]interface{}, len(vals))
+	for i, c := range t.columns {
+		v, err := c.typ.convert(vals[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", t.name, c.name, err)
+		}
+		row[i] = v
+	}
+	return row, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseColType(t *testing.T) {
+	cases := []struct {
+		in  string
+		out colType
+	}{
+		{"INTEGER", typeInteger}, {"int", typeInteger}, {"REAL", typeReal},
+		{"double", typeReal}, {"TEXT", typeText}, {"Boolean", typeBoolean},
+		{"BLOB", typeBlob},
+	}
+	for _, c := range cases {
+		ct, err := parseColType(c.in)
+		assert.NoError(t, err, c.in)
+		assert.Equal(t, c.out, ct, c.in)
+	}
+}
+
+func TestParseColTypeUnknown(t *testing.T) {
+	_, err := parseColType("DECIMAL")
+	assert.Error(t, err)
+}
+
+func TestColTypeString(t *testing.T) {
+	assert.Equal(t, "INTEGER", typeInteger.String())
+	assert.Equal(t, "BLOB", typeBlob.String())
+}
+
+func TestConvertAccepted(t *testing.T) {
+	cases := []struct {
+		typ     colType
+		in, out interface{}
+	}{
+		{typeAny, "any", "any"},
+		{typeInteger, 1, 1},
+		{typeReal, 1.5, 1.5},
+		{typeReal, 1, 1.0},
+		{typeText, "one", "one"},
+		{typeBoolean, true, true},
+		{typeBlob, []byte{1}, []byte{1}},
+		{typeInteger, nil, nil},
+	}
+	for _, c := range cases {
+		v, err := c.typ.convert(c.in)
+		assert.NoError(t, err, "%v %v", c.typ, c.in)
+		assert.Equal(t, c.out, v, "%v %v", c.typ, c.in)
+	}
+}
+
+func TestConvertRejected(t *testing.T) {
+	cases := []struct {
+		typ colType
+		in  interface{}
+	}{
+		{typeInteger, 1.5}, {typeInteger, "1"}, {typeReal, "1.5"},
+		{typeText, 1}, {typeBoolean, 1}, {typeBlob, "blob"},
+	}
+	for _, c := range cases {
+		_, err := c.typ.convert(c.in)
+		assert.Error(t, err, "%v %v", c.typ, c.in)
+	}
+}
+
+func TestCreateTableDuplicateColumn(t *testing.T) {
+	_, err := createTable("TestCreateTableDuplicateColumn", []columnDef{
+		{"id", typeInteger}, {"id", typeText},
+	})
+	assert.Error(t, err)
+	assert.Nil(t, tables["TestCreateTableDuplicateColumn"])
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// compareValues returns -1, 0 or 1 as a is less than, equal to
+// or greater than b. the second result is false
+// when the values are not comparable, e.g. a string and an int
+func compareValues(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case int:
+		switch y := b.(type) {
+		case int:
+			return compareInts(x, y), true
+		case float64:
+			return compareIntFloat(x, y), true
+		}
+	case float64:
+		switch y := b.(type) {
+		case int:
+			return -compareIntFloat(y, x), true
+		case float64:
+			return compareFloats(x, y), true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case y:
+				return -1, true
+			}
+			return 1, true
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y), true
+		}
+	}
+	return 0, false
+}
+
+// compareForSort is a total order over the values for sorting.
+// NULLs are placed at either end, and the values not comparable
+// by compareValues are ordered by their types
+func compareForSort(a, b interface{}, nullsFirst bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil && nullsFirst, b == nil && !nullsFirst:
+		return -1
+	case a == nil, b == nil:
+		return 1
+	}
+	if c, ok := compareValues(a, b); ok {
+		return c
+	}
+	return compareInts(typeRank(a), typeRank(b))
+}
+
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case bool:
+		return 0
+	case int, float64:
+		return 1
+	case string:
+		return 2
+	case []byte:
+		return 3
+	}
+	return 4
+}
+
+func compareInts(x, y int) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// intRange is 2^63, the first float above the ints,
+// which are exactly representable in float64 below it
+const intRange = float64(1 << 63)
+
+// compareIntFloat compares an int with a float exactly, which converting
+// the int to float64 does not for the ones beyond 2^53
+func compareIntFloat(x int, y float64) int {
+	switch {
+	case math.IsNaN(y):
+		return 0
+	case y >= intRange:
+		return -1
+	case y < -intRange:
+		return 1
+	}
+	t := math.Trunc(y)
+	if c := compareInts(x, int(t)); c != 0 {
+		return c
+	}
+	return compareFloats(t, y)
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// hashKey encodes a list of values into a string which can be a map key,
+// so that equal lists have the same key. numbers are compared by value,
+// e.g. 1 and 1.0 are equal, as compareValues does. the whole floats
+// in the range of int are encoded as the ints, and the others cannot
+// be equal to any int
+func hashKey(vals []interface{}) string {
+	var buf strings.Builder
+	for _, v := range vals {
+		switch x := v.(type) {
+		case nil:
+			buf.WriteString("n;")
+		case int:
+			buf.WriteString("i" + strconv.Itoa(x) + ";")
+		case float64:
+			if x == math.Trunc(x) && x >= -intRange && x < intRange {
+				buf.WriteString("i" + strconv.Itoa(int(x)) + ";")
+			} else {
+				buf.WriteString("f" + strconv.FormatFloat(x, 'g', -1, 64) + ";")
+			}
+		case string:
+			buf.WriteString("s" + strconv.Itoa(len(x)) + ":" + x + ";")
+		default:
+			s := fmt.Sprintf("%T:%v", x, x)
+			buf.WriteString("?" + strconv.Itoa(len(s)) + ":" + s + ";")
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCompareValuesComparable(t *testing.T) {
+	cases := []struct {
+		a, b interface{}
+		out  int
+	}{
+		{0, 1, -1}, {1, 1, 0}, {2, 1, 1},
+		{0.5, 1, -1}, {1, 1.0, 0}, {1, 0.5, 1},
+		{"a", "b", -1}, {"b", "b", 0}, {"c", "b", 1},
+		{false, true, -1}, {true, true, 0}, {true, false, 1},
+		{[]byte{1}, []byte{2}, -1}, {[]byte{1}, []byte{1}, 0},
+		{1<<53 + 1, float64(1 << 53), 1}, {float64(1 << 53), 1<<53 + 1, -1},
+		{1 << 60, float64(1 << 60), 0}, {-1, -1.5, 1},
+	}
+	for _, c := range cases {
+		out, ok := compareValues(c.a, c.b)
+		assert.True(t, ok, "%v and %v", c.a, c.b)
+		assert.Equal(t, c.out, out, "%v and %v", c.a, c.b)
+	}
+}
+
+func TestCompareValuesIncomparable(t *testing.T) {
+	cases := []struct{ a, b interface{} }{
+		{0, "0"}, {"0", 0.0}, {nil, 0}, {0, nil}, {nil, nil},
+	}
+	for _, c := range cases {
+		_, ok := compareValues(c.a, c.b)
+		assert.False(t, ok, "%v and %v", c.a, c.b)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	assert.Equal(t, hashKey([]interface{}{1, "a"}), hashKey([]interface{}{1.0, "a"}))
+	assert.NotEqual(t, hashKey([]interface{}{1}), hashKey([]interface{}{"1"}))
+	assert.NotEqual(t, hashKey([]interface{}{nil}), hashKey([]interface{}{}))
+	assert.NotEqual(t,
+		hashKey([]interface{}{"a;", "b"}), hashKey([]interface{}{"a", ";b"}),
+	)
+	assert.NotEqual(t, hashKey([]interface{}{1.5}), hashKey([]interface{}{1}))
+	assert.Equal(t,
+		hashKey([]interface{}{1 << 60}), hashKey([]interface{}{float64(1 << 60)}),
+	)
+}
+
+func TestCompareForSort(t *testing.T) {
+	cases := []struct {
+		a, b       interface{}
+		nullsFirst bool
+		out        int
+	}{
+		{nil, nil, false, 0},
+		{nil, 1, false, 1},
+		{1, nil, false, -1},
+		{nil, 1, true, -1},
+		{1, nil, true, 1},
+		{1, 2.5, false, -1},
+		{"1", 1, false, 1},
+		{true, 0, false, -1},
+		{[]byte{0}, "z", false, 1},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.out, compareForSort(c.a, c.b, c.nullsFirst),
+			"%v and %v", c.a, c.b,
+		)
+	}
+}
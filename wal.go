@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// syncPolicy is when the log is flushed to the disk
+type syncPolicy int
+
+const (
+	// syncAlways syncs every record before the mutation is applied,
+	// so no mutation is lost once it has succeeded
+	syncAlways syncPolicy = iota
+	// syncNever leaves flushing to the OS, which may lose
+	// the latest mutations on a crash of the machine but not of the process
+	syncNever
+)
+
+// the log file consists of the magic header with the generation
+// of the checkpoint, and the records following it. each record is
+// the length and the CRC-32 of its payload, followed by the payload
+const walMagic = "CARAMELWAL\x01"
+
+const walHeaderSize = len(walMagic) + 8
+
+// the kinds of the records, which are the first byte of the payloads.
+// rows are referred to by their rowIDs, which are assigned in the same way
+// when the records are replayed over the snapshot
+const (
+	recCreate byte = iota + 1
+	recDrop
+	recInsert
+	recUpdate
+	recDelete
+	recCreateIndex
+	recBatch
+	recSequence
+)
+
+// wal is the write-ahead log of the mutations since the last checkpoint.
+// once it fails to write, the error is kept and every mutation fails,
+// as the log no longer follows the catalog
+type wal struct {
+	path   string
+	f      *os.File
+	policy syncPolicy
+	gen    uint64
+	err    error
+}
+
+// journal is the log of the catalog, nil unless opened by openWAL
+var journal *wal
+
+// openWAL loads the catalog from the snapshot at path,
+// replays the log at path + ".wal" over it, and logs the mutations after.
+// replaying stops at the first torn or corrupted record,
+// which is what a crash in the middle of writing leaves
+func openWAL(path string, policy syncPolicy) error {
+	if journal != nil {
+		return fmt.Errorf("log already open: %s", journal.path)
+	}
+	loaded := map[string]*table{}
+	gen := uint64(0)
+	f, err := os.Open(path)
+	switch {
+	case err == nil:
+		loaded, gen, err = readCatalog(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	lf, err := os.OpenFile(path+".wal", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	old := tables
+	tables = loaded
+	w := &wal{path: path, f: lf, policy: policy, gen: gen}
+	if err := w.replay(); err != nil {
+		tables = old
+		lf.Close()
+		return fmt.Errorf("%s: %v", lf.Name(), err)
+	}
+	journal = w
+	return nil
+}
+
+// checkpoint saves the snapshot of the catalog, and empties the log.
+// the snapshot has the next generation, so the log left by a crash
+// before emptying it is known to be older and ignored
+func checkpoint() error {
+	w := journal
+	if w == nil {
+		return fmt.Errorf("no log is open")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if err := saveSnapshot(w.path, w.gen+1); err != nil {
+		return err
+	}
+	w.gen++
+	if err := w.reset(); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// closeWAL stops logging, leaving the log to be replayed by openWAL
+func closeWAL() error {
+	w := journal
+	if w == nil {
+		return nil
+	}
+	journal = nil
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// failure is the error by which the log failed, if any
+func (w *wal) failure() error {
+	if w == nil {
+		return nil
+	}
+	return w.err
+}
+
+// log appends the record, doing nothing if no log is open.
+// the records in a transaction are kept by it until the commit
+func (w *wal) log(rec *bytes.Buffer) error {
+	if err := w.failure(); err != nil {
+		return err
+	}
+	if activeTx != nil {
+		activeTx.records = append(activeTx.records, rec.Bytes())
+		return nil
+	}
+	if w == nil {
+		return nil
+	}
+	if err := w.append(rec.Bytes()); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// logSequence logs the state of the sequence at once, even in a transaction,
+// since the values are not reused after rolled back. the transaction
+// logs it again, after the table of it if created in the transaction
+func (w *wal) logSequence(s *sequence) error {
+	rec := &bytes.Buffer{}
+	rec.WriteByte(recSequence)
+	writeString(rec, s.name)
+	writeUvarint(rec, uint64(s.next))
+	if activeTx != nil {
+		activeTx.records = append(activeTx.records, rec.Bytes())
+	}
+	if err := w.failure(); err != nil || w == nil {
+		return err
+	}
+	if err := w.append(rec.Bytes()); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// logTable logs the mutation of t,
+// unless t is not in the catalog or is not kept in memory.
+// in a transaction, the state of t is saved before it is modified
+func (w *wal) logTable(t *table, rec *bytes.Buffer) error {
+	if activeTx != nil {
+		if err := w.failure(); err != nil {
+			return err
+		}
+		if err := activeTx.track(t); err != nil {
+			return err
+		}
+	}
+	if _, ok := t.store.(*memStore); !ok || tables[t.name] != t {
+		return nil
+	}
+	return w.log(rec)
+}
+
+func (w *wal) append(payload []byte) error {
+	// a record is written at once not to interleave with others
+	buf := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(payload))
+	buf = append(buf, payload...)
+	if _, err := w.f.Write(buf); err != nil {
+		return err
+	}
+	if w.policy == syncAlways {
+		return w.f.Sync()
+	}
+	return nil
+}
+
+// reset empties the log, leaving only the header of the generation
+func (w *wal) reset() error {
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	header := make([]byte, walHeaderSize)
+	copy(header, walMagic)
+	binary.LittleEndian.PutUint64(header[len(walMagic):], w.gen)
+	if _, err := w.f.Write(header); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+func (w *wal) replay() error {
+	info, err := w.f.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(w.f)
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		// a new log, or one torn while being reset
+		return w.reset()
+	}
+	if string(header[:len(walMagic)]) != walMagic {
+		return fmt.Errorf("not a log file")
+	}
+	if binary.LittleEndian.Uint64(header[len(walMagic):]) != w.gen {
+		// the snapshot was saved after the log, so it has all the records
+		return w.reset()
+	}
+	end := int64(walHeaderSize)
+	frame := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, frame); err != nil {
+			break
+		}
+		n := int64(binary.LittleEndian.Uint32(frame))
+		if end+8+n > info.Size() {
+			break
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(frame[4:]) {
+			break
+		}
+		if err := applyRecord(payload); err != nil {
+			return err
+		}
+		end += 8 + n
+	}
+	// the torn tail is cut off, so that the new records follow the valid ones
+	if err := w.f.Truncate(end); err != nil {
+		return err
+	}
+	_, err = w.f.Seek(end, io.SeekStart)
+	return err
+}
+
+func createRecord(t *table) *bytes.Buffer {
+	rec := &bytes.Buffer{}
+	rec.WriteByte(recCreate)
+	writeSchema(rec, t)
+	return rec
+}
+
+func createIndexRecord(
+	name, ixName, colName string, kind indexKind,
+) *bytes.Buffer {
+	rec := &bytes.Buffer{}
+	rec.WriteByte(recCreateIndex)
+	writeString(rec, name)
+	writeString(rec, ixName)
+	writeString(rec, colName)
+	rec.WriteByte(byte(kind))
+	return rec
+}
+
+func dropRecord(name string) *bytes.Buffer {
+	rec := &bytes.Buffer{}
+	rec.WriteByte(recDrop)
+	writeString(rec, name)
+	return rec
+}
+
+// the values have been validated by the table, so they can be encoded
+func insertRecord(name string, row []interface{}) *bytes.Buffer {
+	rec := &bytes.Buffer{}
+	rec.WriteByte(recInsert)
+	writeString(rec, name)
+	writeRow(rec, row)
+	return rec
+}
+
+func updateRecord(name string, rids []rowID, rows [][]interface{}) *bytes.Buffer {
+	rec := &bytes.Buffer{}
+	rec.WriteByte(recUpdate)
+	writeString(rec, name)
+	writeUvarint(rec, uint64(len(rows)))
+	for i, row := range rows {
+		writeUvarint(rec, uint64(rids[i]))
+		writeRow(rec, row)
+	}
+	return rec
+}
+
+func deleteRecord(name string, rids []rowID) *bytes.Buffer {
+	rec := &bytes.Buffer{}
+	rec.WriteByte(recDelete)
+	writeString(rec, name)
+	writeUvarint(rec, uint64(len(rids)))
+	for _, rid := range rids {
+		writeUvarint(rec, uint64(rid))
+	}
+	return rec
+}
+
+func writeRow(w byteWriter, row []interface{}) {
+	writeUvarint(w, uint64(len(row)))
+	for _, v := range row {
+		writeValue(w, v)
+	}
+}
+
+func readRow(r byteReader) ([]interface{}, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	row := []interface{}{}
+	for i := uint64(0); i < n; i++ {
+		v, err := readValue(r)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, v)
+	}
+	return row, nil
+}
+
+// applyRecord redoes the mutation of the record on the catalog
+func applyRecord(payload []byte) error {
+	r := bytes.NewReader(payload)
+	kind, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case recCreate:
+		t, err := readSchema(r)
+		if err != nil {
+			return err
+		}
+		tables[t.name] = t
+		return nil
+	case recBatch:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < n; i++ {
+			payload, err := readString(r)
+			if err != nil {
+				return err
+			}
+			if err := applyRecord([]byte(payload)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case recSequence:
+		name, err := readString(r)
+		if err != nil {
+			return err
+		}
+		next, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		// the sequence of a table created in a transaction
+		// is not known before its commit, which has the state of it
+		if s := findSequence(name); s != nil && int(next) > s.next {
+			s.next = int(next)
+		}
+		return nil
+	}
+	name, err := readString(r)
+	if err != nil {
+		return err
+	}
+	t, err := lookupTable(name)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case recDrop:
+		delete(tables, name)
+	case recInsert:
+		row, err := readRow(r)
+		if err != nil {
+			return err
+		}
+		_, err = t.insertRow(row)
+		return err
+	case recUpdate:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < n; i++ {
+			rid, err := binary.ReadUvarint(r)
+			if err != nil {
+				return err
+			}
+			row, err := readRow(r)
+			if err != nil {
+				return err
+			}
+			cur, err := t.store.fetch(rowID(rid))
+			if err == nil {
+				_, err = t.updateRow(cur, row)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: row %d: %v", name, rid, err)
+			}
+		}
+	case recDelete:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < n; i++ {
+			rid, err := binary.ReadUvarint(r)
+			if err != nil {
+				return err
+			}
+			cur, err := t.store.fetch(rowID(rid))
+			if err == nil {
+				err = t.deleteRow(cur)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: row %d: %v", name, rid, err)
+			}
+		}
+	case recCreateIndex:
+		ixName, err := readString(r)
+		if err != nil {
+			return err
+		}
+		colName, err := readString(r)
+		if err != nil {
+			return err
+		}
+		kind, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		idx, err := t.lookupColumn(colName)
+		if err != nil {
+			return err
+		}
+		_, err = t.buildIndex(ixName, idx, indexKind(kind))
+		return err
+	default:
+		return fmt.Errorf("unknown record kind: %d", kind)
+	}
+	return nil
+}
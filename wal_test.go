@@ -0,0 +1,165 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withWAL runs f with the catalog opened from the files under the path,
+// closing the log and restoring the original catalog after it
+func withWAL(t *testing.T, path string, f func()) {
+	withCatalog(func() {
+		defer closeWAL()
+		if assert.NoError(t, openWAL(path, syncAlways)) {
+			f()
+		}
+	})
+}
+
+func walStatements(t *testing.T) {
+	for _, src := range []string{
+		"CREATE TABLE items (id INTEGER, name TEXT, price REAL)",
+		"INSERT INTO items VALUES (0, 'apple', 300), (1, 'orange', 130)",
+		"INSERT INTO items VALUES (2, 'cabbage', 200), (3, NULL, NULL)",
+		"UPDATE items SET price = 250 WHERE id = 0",
+		"DELETE FROM items WHERE id = 1",
+		"CREATE TABLE types (id, name)",
+		"DROP TABLE types",
+	} {
+		_, err := exec(src)
+		assert.NoError(t, err, src)
+	}
+}
+
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	var logged map[string]*relation
+	withWAL(t, path, func() {
+		walStatements(t)
+		logged = scanCatalog()
+	})
+	withWAL(t, path, func() {
+		assert.Equal(t, logged, scanCatalog())
+		assert.Equal(t, 3, len(from("items").tuples))
+		assert.Equal(t,
+			[]interface{}{0, "apple", 250.0}, from("items").tuples[0].values,
+		)
+	})
+}
+
+func TestWALTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		walStatements(t)
+	})
+	data, _ := os.ReadFile(path + ".wal")
+	for _, n := range []int{1, 5, 9} {
+		// the last record is the drop of types
+		os.WriteFile(path+".wal", data[:len(data)-n], 0644)
+		withWAL(t, path, func() {
+			assert.NotNil(t, tables["types"])
+			assert.Equal(t, 3, len(from("items").tuples))
+		})
+	}
+	withWAL(t, path, func() {
+		tables["items"].insert(4, "saury", 220.0)
+	})
+	withWAL(t, path, func() {
+		assert.NotNil(t, tables["types"], "it should not replay the torn tail")
+		assert.Equal(t, 4, len(from("items").tuples))
+	})
+}
+
+func TestWALInsertStatement(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		exec("CREATE TABLE items (id INTEGER, name TEXT)")
+		exec("INSERT INTO items VALUES (0, 'apple'), (1, 'orange'), (2, NULL)")
+	})
+	data, _ := os.ReadFile(path + ".wal")
+	os.WriteFile(path+".wal", data[:len(data)-1], 0644)
+	withWAL(t, path, func() {
+		assert.Equal(t, 0, len(from("items").tuples),
+			"the torn statement should insert no rows")
+	})
+}
+
+func TestWALDeleteCascade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		exec("CREATE TABLE types (type_id INTEGER PRIMARY KEY)")
+		exec("CREATE TABLE items (id INTEGER, " +
+			"type_id INTEGER REFERENCES types ON DELETE CASCADE)")
+		exec("INSERT INTO types VALUES (1), (2)")
+		exec("INSERT INTO items VALUES (0, 1), (1, 2)")
+		exec("DELETE FROM types WHERE type_id = 1")
+	})
+	data, _ := os.ReadFile(path + ".wal")
+	os.WriteFile(path+".wal", data[:len(data)-1], 0644)
+	withWAL(t, path, func() {
+		assert.Equal(t, []interface{}{1, 2}, ids(from("types")),
+			"the torn statement should delete no rows")
+		assert.Equal(t, []interface{}{0, 1}, ids(from("items")))
+	})
+}
+
+func TestWALChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		walStatements(t)
+	})
+	data, _ := os.ReadFile(path + ".wal")
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path+".wal", data, 0644)
+	withWAL(t, path, func() {
+		assert.NotNil(t, tables["types"])
+	})
+}
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	var logged map[string]*relation
+	withWAL(t, path, func() {
+		walStatements(t)
+		assert.NoError(t, checkpoint())
+		logged = scanCatalog()
+	})
+	info, _ := os.Stat(path + ".wal")
+	assert.Equal(t, int64(walHeaderSize), info.Size())
+	withWAL(t, path, func() {
+		assert.Equal(t, logged, scanCatalog())
+	})
+}
+
+func TestCheckpointStaleLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		walStatements(t)
+		stale, _ := os.ReadFile(path + ".wal")
+		assert.NoError(t, checkpoint())
+		// a crash after saving the snapshot leaves the log as it was
+		os.WriteFile(path+".wal", stale, 0644)
+	})
+	withWAL(t, path, func() {
+		assert.Equal(t, 3, len(from("items").tuples))
+		tables["items"].insert(4, "saury", 220.0)
+	})
+	withWAL(t, path, func() {
+		assert.Equal(t, 4, len(from("items").tuples))
+	})
+}
+
+func TestWALFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	withWAL(t, path, func() {
+		walStatements(t)
+		journal.f.Close()
+		assert.Error(t, tables["items"].insert(4, "saury", 220.0))
+		assert.Equal(t, 3, len(from("items").tuples))
+		_, err := exec("DELETE FROM items")
+		assert.Error(t, err)
+		assert.Error(t, checkpoint())
+	})
+}